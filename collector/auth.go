@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var (
+	errMissingAuth = errors.New("collector: missing auth key")
+	errInvalidAuth = errors.New("collector: invalid auth key")
+)
+
+// checkAuthKey compares key against every configured key in constant
+// time, so neither the match nor its position leak through timing.
+func checkAuthKey(key string, keys []string) bool {
+	match := 0
+	for _, k := range keys {
+		match |= subtle.ConstantTimeCompare([]byte(key), []byte(k))
+	}
+	return match == 1
+}
+
+// authenticated wraps a webhook handler, rejecting requests that don't
+// carry one of the configured auth keys. The key may be sent bare or
+// as a bearer token.
+func authenticated(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(config.TTN.AuthHeader())
+		key = strings.TrimPrefix(key, "Bearer ")
+		if key == "" {
+			httpError(w, errMissingAuth, http.StatusUnauthorized)
+			return
+		}
+
+		if !checkAuthKey(key, config.TTN.AuthKeys()) {
+			httpError(w, errInvalidAuth, http.StatusForbidden)
+			return
+		}
+
+		h(w, r)
+	}
+}
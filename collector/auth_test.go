@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kisom/goutils/assert"
+)
+
+func TestAuthenticated(t *testing.T) {
+	ok := authenticated(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	tests := []struct {
+		name   string
+		cfg    map[string]string
+		header string
+		value  string
+		status int
+	}{
+		{"missing header", nil, "", "", http.StatusUnauthorized},
+		{"empty bearer", nil, "Authorization", "Bearer ", http.StatusUnauthorized},
+		{"wrong key", nil, "Authorization", "hunter2", http.StatusForbidden},
+		{"wrong bearer key", nil, "Authorization", "Bearer hunter2", http.StatusForbidden},
+		{"bare key", nil, "Authorization", "current", http.StatusOK},
+		{"bearer key", nil, "Authorization", "Bearer current", http.StatusOK},
+		{"rotated key", nil, "Authorization", "Bearer previous", http.StatusOK},
+		{"prefix of a key", nil, "Authorization", "curr", http.StatusForbidden},
+		{"custom header", map[string]string{"auth_header": "X-Downlink-Apikey"},
+			"X-Downlink-Apikey", "current", http.StatusOK},
+		{"default header with custom header set",
+			map[string]string{"auth_header": "X-Downlink-Apikey"},
+			"Authorization", "current", http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		cfg := map[string]string{
+			"app_id":     "fls",
+			"access_key": "ttn-account-v2.secret",
+			"auth_key":   "current, previous",
+		}
+		for k, v := range test.cfg {
+			cfg[k] = v
+		}
+
+		ttn, err := TTNFromMap(cfg)
+		assert.NoErrorT(t, err)
+		config = &Config{TTN: ttn}
+
+		req := httptest.NewRequest("POST", "/fls/collector/uplink", nil)
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+
+		w := httptest.NewRecorder()
+		ok(w, req)
+		assert.BoolT(t, w.Code == test.status,
+			fmt.Sprintf("%s: expected %d, got %d", test.name, test.status, w.Code))
+		if test.status == http.StatusOK {
+			assert.BoolT(t, w.Body.String() == "ok", test.name+": handler not called")
+		}
+	}
+}
+
+func TestCheckAuthKey(t *testing.T) {
+	keys := []string{"current", "previous"}
+	assert.BoolT(t, checkAuthKey("current", keys), "first key")
+	assert.BoolT(t, checkAuthKey("previous", keys), "second key")
+	assert.BoolT(t, !checkAuthKey("other", keys), "unknown key")
+	assert.BoolT(t, !checkAuthKey("current", nil), "no keys")
+}
@@ -0,0 +1,173 @@
+// Package chirpstack decodes events posted by the ChirpStack HTTP
+// integration.
+package chirpstack
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kisom/redenv/collector/reading"
+	"github.com/kisom/redenv/collector/ttn"
+)
+
+// EventUplink is the value of the event query parameter ChirpStack
+// sets when posting an uplink; other events (join, status, ack, ...)
+// are posted to the same URL.
+const EventUplink = "up"
+
+// DeviceInfo identifies the device that sent an event.
+type DeviceInfo struct {
+	TenantID          string            `json:"tenantId"`
+	TenantName        string            `json:"tenantName"`
+	ApplicationID     string            `json:"applicationId"`
+	ApplicationName   string            `json:"applicationName"`
+	DeviceProfileID   string            `json:"deviceProfileId"`
+	DeviceProfileName string            `json:"deviceProfileName"`
+	DeviceName        string            `json:"deviceName"`
+	DevEUI            string            `json:"devEui"`
+	Tags              map[string]string `json:"tags"`
+}
+
+// Location is a gateway's reported position.
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Altitude  float64 `json:"altitude"`
+}
+
+// RxInfo is a single gateway's reception of an uplink.
+type RxInfo struct {
+	GatewayID string    `json:"gatewayId"`
+	UplinkID  uint32    `json:"uplinkId"`
+	GwTime    string    `json:"gwTime"`
+	NsTime    string    `json:"nsTime"`
+	RSSI      int       `json:"rssi"`
+	SNR       float32   `json:"snr"`
+	Channel   int       `json:"channel"`
+	RFChain   int       `json:"rfChain"`
+	Location  *Location `json:"location"`
+	Context   string    `json:"context"`
+	CRCStatus string    `json:"crcStatus"`
+}
+
+// LoRaModulation describes a LoRa transmission.
+type LoRaModulation struct {
+	Bandwidth       int    `json:"bandwidth"`
+	SpreadingFactor int    `json:"spreadingFactor"`
+	CodeRate        string `json:"codeRate"`
+}
+
+// FSKModulation describes an FSK transmission.
+type FSKModulation struct {
+	FrequencyDeviation int `json:"frequencyDeviation"`
+	Datarate           int `json:"datarate"`
+}
+
+// Modulation holds whichever modulation the uplink was sent with.
+type Modulation struct {
+	LoRa *LoRaModulation `json:"lora"`
+	FSK  *FSKModulation  `json:"fsk"`
+}
+
+// TxInfo describes how an uplink was transmitted.
+type TxInfo struct {
+	Frequency  int        `json:"frequency"`
+	Modulation Modulation `json:"modulation"`
+}
+
+// Uplink is a ChirpStack uplink event.
+type Uplink struct {
+	DeduplicationID string          `json:"deduplicationId"`
+	Time            string          `json:"time"`
+	DeviceInfo      DeviceInfo      `json:"deviceInfo"`
+	DevAddr         string          `json:"devAddr"`
+	ADR             bool            `json:"adr"`
+	DR              int             `json:"dr"`
+	FCnt            int             `json:"fCnt"`
+	FPort           int             `json:"fPort"`
+	Confirmed       bool            `json:"confirmed"`
+	Data            string          `json:"data"`
+	Object          json.RawMessage `json:"object"`
+	RxInfo          []RxInfo        `json:"rxInfo"`
+	TxInfo          TxInfo          `json:"txInfo"`
+}
+
+// CodingRate converts ChirpStack's "CR_4_5" into the "4/5" form TTN
+// uses.
+func CodingRate(cr string) string {
+	cr = strings.TrimPrefix(cr, "CR_")
+	return strings.Replace(cr, "_", "/", 1)
+}
+
+func (u *Uplink) receivedAt() string {
+	if u.Time != "" {
+		return u.Time
+	}
+
+	for _, rx := range u.RxInfo {
+		if rx.NsTime != "" {
+			return rx.NsTime
+		}
+	}
+
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// Uplink converts the event into the TTN v2 form the collector
+// stores.
+func (u *Uplink) Uplink() *ttn.Uplink {
+	up := &ttn.Uplink{
+		AppID:          u.DeviceInfo.ApplicationName,
+		DevID:          u.DeviceInfo.DeviceName,
+		HardwareSerial: strings.ToUpper(u.DeviceInfo.DevEUI),
+		Port:           u.FPort,
+		Counter:        u.FCnt,
+		Confirmed:      u.Confirmed,
+		PayloadRaw:     u.Data,
+		PayloadFields:  u.Object,
+		Metadata: ttn.Metadata{
+			Time:      u.receivedAt(),
+			Frequency: ttn.Number(u.TxInfo.Frequency) / 1000000,
+		},
+	}
+
+	for _, rx := range u.RxInfo {
+		gw := ttn.Gateway{
+			GatewayID: strings.ToUpper(rx.GatewayID),
+			Time:      rx.GwTime,
+			Channel:   rx.Channel,
+			RSSI:      float32(rx.RSSI),
+			SNR:       rx.SNR,
+			RFChain:   rx.RFChain,
+		}
+
+		if rx.Location != nil {
+			loc := *rx.Location
+			gw.Latitude = &loc.Latitude
+			gw.Longitude = &loc.Longitude
+			gw.Altitude = &loc.Altitude
+		}
+		up.Metadata.Gateways = append(up.Metadata.Gateways, gw)
+	}
+
+	mod := u.TxInfo.Modulation
+	switch {
+	case mod.LoRa != nil:
+		up.Metadata.Modulation = "LORA"
+		up.Metadata.DataRate = ttn.Text(fmt.Sprintf("SF%dBW%d",
+			mod.LoRa.SpreadingFactor, mod.LoRa.Bandwidth/1000))
+		up.Metadata.CodingRate = ttn.Text(CodingRate(mod.LoRa.CodeRate))
+	case mod.FSK != nil:
+		up.Metadata.Modulation = "FSK"
+		up.Metadata.BitRate = ttn.Text(fmt.Sprint(mod.FSK.Datarate))
+	}
+
+	return up
+}
+
+// ToReading decodes the uplink's payload.
+func (u *Uplink) ToReading() (*reading.Reading, error) {
+	return u.Uplink().ToReading()
+}
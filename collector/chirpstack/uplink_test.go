@@ -0,0 +1,72 @@
+package chirpstack
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kisom/goutils/assert"
+)
+
+var upEvent = []byte(`{
+  "deduplicationId": "3ac8c8a5-3bba-4d7c-a9b5-6a4e9c5d2c1a",
+  "time": "2019-10-29T11:30:05.094175318Z",
+  "deviceInfo": {
+    "tenantId": "52f14cd4-c6f1-4fbd-8f87-4025e1d49242",
+    "tenantName": "fls",
+    "applicationId": "ca739e26-7b67-4f14-b69e-d568c22a5a75",
+    "applicationName": "fls",
+    "deviceProfileId": "f2a1f9b6-1b5a-4b1f-8d34-5c9f3d9e5a21",
+    "deviceProfileName": "redenv",
+    "deviceName": "backyard",
+    "devEui": "009cb1747141cd05",
+    "tags": {}
+  },
+  "devAddr": "00189440",
+  "adr": true,
+  "dr": 3,
+  "fCnt": 2,
+  "fPort": 1,
+  "confirmed": false,
+  "data": "4wcKHQseBA+rCAAAr0edQRyF80AAqvRBwnvGRz8CAAAaAAAA/QABAAA=",
+  "rxInfo": [{
+    "gatewayId": "b827ebfffe5e1a2b",
+    "uplinkId": 24213,
+    "nsTime": "2019-10-29T11:30:05.090Z",
+    "rssi": -79,
+    "snr": 9.25,
+    "channel": 2,
+    "location": {"latitude": 37.823, "longitude": -122.284},
+    "context": "EFwMtA==",
+    "crcStatus": "CRC_OK"
+  }],
+  "txInfo": {
+    "frequency": 904300000,
+    "modulation": {
+      "lora": {"bandwidth": 125000, "spreadingFactor": 7, "codeRate": "CR_4_5"}
+    }
+  }
+}`)
+
+func TestUplink(t *testing.T) {
+	u := &Uplink{}
+	err := json.Unmarshal(upEvent, u)
+	assert.NoErrorT(t, err)
+
+	up := u.Uplink()
+	assert.BoolT(t, up.AppID == "fls", "app ID")
+	assert.BoolT(t, up.DevID == "backyard", "device ID")
+	assert.BoolT(t, up.HardwareSerial == "009CB1747141CD05", "hardware serial")
+	assert.BoolT(t, up.Port == 1, "port")
+	assert.BoolT(t, up.Counter == 2, "counter")
+	assert.BoolT(t, up.Metadata.Modulation == "LORA", "modulation")
+	assert.BoolT(t, up.Metadata.DataRate == "SF7BW125", "data rate")
+
+	r, err := u.ToReading()
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, r.Device == "backyard", "device")
+	assert.BoolT(t, r.Uptime == 2219, "uptime")
+
+	expectedDate := time.Date(2019, 10, 29, 11, 30, 4, 0, time.UTC)
+	assert.BoolT(t, r.When.Equal(expectedDate), "timestamp")
+}
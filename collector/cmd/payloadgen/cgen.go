@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/kisom/redenv/collector/schema"
+)
+
+var cTypes = map[string]string{
+	schema.Uint8:   "uint8_t",
+	schema.Uint16:  "uint16_t",
+	schema.Uint32:  "uint32_t",
+	schema.Int32:   "int32_t",
+	schema.Float32: "float",
+	schema.Bool:    "uint8_t",
+}
+
+func cField(buf *bytes.Buffer, f schema.Field) {
+	comment := f.Comment
+	switch {
+	case comment == "":
+		comment = f.Unit
+	case f.Unit != "":
+		comment += " (" + f.Unit + ")"
+	}
+
+	if f.Type == schema.DateTime {
+		fmt.Fprintf(buf, "\tuint16_t\tyear;")
+		if comment != "" {
+			fmt.Fprintf(buf, "\t// %s: %s", f.Name, comment)
+		}
+		fmt.Fprintln(buf)
+		for _, part := range []string{"month", "day", "hour", "minute", "second"} {
+			fmt.Fprintf(buf, "\tuint8_t\t\t%s;\n", part)
+		}
+		return
+	}
+
+	ctype := cTypes[f.Type]
+	tabs := "\t"
+	if len(ctype) < 8 {
+		tabs = "\t\t"
+	}
+
+	fmt.Fprintf(buf, "\t%s%s%s;", ctype, tabs, f.Name)
+	if comment != "" {
+		fmt.Fprintf(buf, "\t// %s", comment)
+	}
+	fmt.Fprintln(buf)
+}
+
+func genC(s *schema.Schema, source string) []byte {
+	var buf bytes.Buffer
+	guard := strings.ToUpper(s.Name) + "_READING_H"
+	current := s.Current()
+
+	fmt.Fprintf(&buf, "/*\n * %s\n *\n", header(source))
+	if s.Comment != "" {
+		fmt.Fprintf(&buf, " * %s\n", s.Comment)
+	}
+	fmt.Fprintf(&buf, ` * Define READING_VERSION before including this header to send an
+ * older layout. The struct is copied onto the air as is, so this
+ * assumes a %s-endian MCU.
+ *
+ * It can be unpacked with the following Python struct formats:
+`, s.Endian)
+	for _, v := range s.Versions {
+		fmt.Fprintf(&buf, " * \tversion %d: '%s'\n", v, pythonFormat(s, v))
+	}
+	fmt.Fprintf(&buf, " */\n\n#ifndef %s\n#define %s\n\n\n#include <stdint.h>\n\n\n", guard, guard)
+
+	fmt.Fprintf(&buf, "#ifndef READING_VERSION\n#define READING_VERSION\t%d\n#endif\n\n", current)
+	for i, v := range s.Versions {
+		directive := "#elif"
+		if i == 0 {
+			directive = "#if"
+		}
+		fmt.Fprintf(&buf, "%s READING_VERSION == %d\n#define READING_SIZE\t%d\t/* how big is the reading struct in bytes */\n",
+			directive, v, s.Size(v))
+	}
+	fmt.Fprintf(&buf, "#else\n#error \"unknown READING_VERSION\"\n#endif\n\n\n")
+
+	fmt.Fprintf(&buf, "struct Reading {\n")
+	since := 0
+	for _, f := range s.Fields {
+		if f.Since != since {
+			if since > 0 {
+				fmt.Fprintf(&buf, "#endif\n")
+			}
+			if f.Since > 0 {
+				fmt.Fprintf(&buf, "#if READING_VERSION >= %d\n", f.Since)
+			}
+			since = f.Since
+		}
+		cField(&buf, f)
+	}
+	if since > 0 {
+		fmt.Fprintf(&buf, "#endif\n")
+	}
+	fmt.Fprintf(&buf, "} __attribute__((packed));\n\n\n#endif /* %s */\n", guard)
+
+	return buf.Bytes()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strings"
+
+	"github.com/kisom/redenv/collector/schema"
+)
+
+func sizeConst(v int) string {
+	return fmt.Sprintf("ReadingSizeV%d", v)
+}
+
+func byteOrder(s *schema.Schema) string {
+	if s.Endian == "big" {
+		return "binary.BigEndian"
+	}
+	return "binary.LittleEndian"
+}
+
+// goDecode returns the statement decoding f at offset off.
+func goDecode(s *schema.Schema, f schema.Field, off int) string {
+	bo := byteOrder(s)
+	dst := "r." + f.Go
+
+	switch f.Type {
+	case schema.Uint8:
+		return fmt.Sprintf("%s = data[%d]", dst, off)
+	case schema.Uint16:
+		return fmt.Sprintf("%s = %s.Uint16(data[%d:])", dst, bo, off)
+	case schema.Uint32:
+		return fmt.Sprintf("%s = %s.Uint32(data[%d:])", dst, bo, off)
+	case schema.Int32:
+		return fmt.Sprintf("%s = int32(%s.Uint32(data[%d:]))", dst, bo, off)
+	case schema.Float32:
+		return fmt.Sprintf("%s = math.Float32frombits(%s.Uint32(data[%d:]))", dst, bo, off)
+	case schema.Bool:
+		return fmt.Sprintf("%s = data[%d] == 1", dst, off)
+	case schema.DateTime:
+		return fmt.Sprintf(`%s = time.Date(int(%s.Uint16(data[%d:])), time.Month(data[%d]),
+	int(data[%d]), int(data[%d]), int(data[%d]), int(data[%d]), 0, time.UTC)`,
+			dst, bo, off, off+2, off+3, off+4, off+5, off+6)
+	}
+
+	panic("payloadgen: unknown type " + f.Type)
+}
+
+// goEncode returns the statement encoding f at offset off.
+func goEncode(s *schema.Schema, f schema.Field, off int) string {
+	bo := byteOrder(s)
+	src := "r." + f.Go
+
+	switch f.Type {
+	case schema.Uint8:
+		return fmt.Sprintf("data[%d] = %s", off, src)
+	case schema.Uint16:
+		return fmt.Sprintf("%s.PutUint16(data[%d:], %s)", bo, off, src)
+	case schema.Uint32:
+		return fmt.Sprintf("%s.PutUint32(data[%d:], %s)", bo, off, src)
+	case schema.Int32:
+		return fmt.Sprintf("%s.PutUint32(data[%d:], uint32(%s))", bo, off, src)
+	case schema.Float32:
+		return fmt.Sprintf("%s.PutUint32(data[%d:], math.Float32bits(%s))", bo, off, src)
+	case schema.Bool:
+		return fmt.Sprintf("data[%d] = boolByte(%s)", off, src)
+	case schema.DateTime:
+		return fmt.Sprintf(`when := %s.UTC()
+%s.PutUint16(data[%d:], uint16(when.Year()))
+data[%d] = uint8(when.Month())
+data[%d] = uint8(when.Day())
+data[%d] = uint8(when.Hour())
+data[%d] = uint8(when.Minute())
+data[%d] = uint8(when.Second())`,
+			src, bo, off, off+2, off+3, off+4, off+5, off+6)
+	}
+
+	panic("payloadgen: unknown type " + f.Type)
+}
+
+func genGo(s *schema.Schema, source string) ([]byte, error) {
+	var body bytes.Buffer
+	imports := map[string]bool{}
+
+	for _, v := range s.Versions {
+		fmt.Fprintf(&body, "\nfunc (r *Reading) unmarshalV%d(data []byte) error {\n", v)
+		fmt.Fprintf(&body, "if len(data) != %s {\nreturn ErrUnknownLayout\n}\n\n", sizeConst(v))
+
+		off := 0
+		for _, f := range s.FieldsFor(v) {
+			if f.Go != "" {
+				fmt.Fprintln(&body, goDecode(s, f, off))
+			}
+			off += f.Size()
+		}
+		fmt.Fprintf(&body, "return nil\n}\n")
+
+		fmt.Fprintf(&body, "\nfunc (r *Reading) marshalV%d() ([]byte, error) {\n", v)
+		fmt.Fprintf(&body, "data := make([]byte, %s)\n", sizeConst(v))
+
+		off = 0
+		for _, f := range s.FieldsFor(v) {
+			if f.Go != "" {
+				fmt.Fprintln(&body, goEncode(s, f, off))
+			}
+			off += f.Size()
+
+			switch f.Type {
+			case schema.Float32:
+				imports["math"] = true
+			case schema.DateTime:
+				imports["time"] = true
+			}
+			if f.Size() > 1 {
+				imports["encoding/binary"] = true
+			}
+		}
+		fmt.Fprintf(&body, "return data, nil\n}\n")
+	}
+
+	fmt.Fprintf(&body, "\n// generatedLayouts are registered with the DefaultRegistry.\n")
+	fmt.Fprintf(&body, "var generatedLayouts = []*Layout{\n")
+	for _, v := range s.Versions {
+		fmt.Fprintf(&body, "{\nName: %q,\nSize: %s,\nDecode: (*Reading).unmarshalV%d,\nEncode: (*Reading).marshalV%d,\n},\n",
+			s.LayoutName(v), sizeConst(v), v, v)
+	}
+	fmt.Fprintf(&body, "}\n")
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// %s\n\npackage reading\n\nimport (\n", header(source))
+	for _, imp := range []string{"encoding/binary", "math", "time"} {
+		if imports[imp] {
+			fmt.Fprintf(&out, "%q\n", imp)
+		}
+	}
+	fmt.Fprintf(&out, ")\n\nconst (\n")
+	for _, v := range s.Versions {
+		fmt.Fprintf(&out, "// %s is the length of a %s payload.\n%s = %d\n\n",
+			sizeConst(v), s.LayoutName(v), sizeConst(v), s.Size(v))
+	}
+	fmt.Fprintf(&out, "// ReadingSize is the length of the current payload.\nReadingSize = %s\n\n",
+		sizeConst(s.Current()))
+	fmt.Fprintf(&out, "// CurrentLayout is the layout sent by the current firmware.\nCurrentLayout = %q\n)\n",
+		s.LayoutName(s.Current()))
+
+	var scales []string
+	for _, f := range s.Fields {
+		if f.Scale != 0 && f.Go != "" {
+			scales = append(scales, fmt.Sprintf("%sScale = %v", f.Go, f.Scale))
+		}
+	}
+	if len(scales) > 0 {
+		fmt.Fprintf(&out, "\n// Scales convert raw values into their units.\nconst (\n%s\n)\n",
+			strings.Join(scales, "\n"))
+	}
+
+	out.Write(body.Bytes())
+	return format.Source(out.Bytes())
+}
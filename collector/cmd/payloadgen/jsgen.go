@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/kisom/redenv/collector/schema"
+)
+
+// The formatter runs in the TTN and ChirpStack JavaScript sandboxes,
+// which don't have DataView everywhere, so it sticks to ES5 and
+// decodes floats by hand.
+const jsLittleEndian = `function u16(b, i) {
+	return b[i] | (b[i + 1] << 8);
+}
+
+function u32(b, i) {
+	return (b[i] | (b[i + 1] << 8) | (b[i + 2] << 16) | (b[i + 3] << 24)) >>> 0;
+}
+`
+
+const jsBigEndian = `function u16(b, i) {
+	return (b[i] << 8) | b[i + 1];
+}
+
+function u32(b, i) {
+	return ((b[i] << 24) | (b[i + 1] << 16) | (b[i + 2] << 8) | b[i + 3]) >>> 0;
+}
+`
+
+const jsHelpers = `
+function i32(b, i) {
+	return u32(b, i) | 0;
+}
+
+function f32(b, i) {
+	var bits = u32(b, i);
+	var sign = (bits >>> 31) ? -1 : 1;
+	var exp = (bits >>> 23) & 0xff;
+	var frac = bits & 0x7fffff;
+
+	if (exp === 0xff) {
+		return frac ? NaN : sign * Infinity;
+	}
+	if (exp === 0) {
+		return sign * frac * Math.pow(2, -149);
+	}
+	return sign * (1 + frac / 0x800000) * Math.pow(2, exp - 127);
+}
+
+function pad(n) {
+	return (n < 10 ? "0" : "") + n;
+}
+
+// sensor returns null for a value from a sensor that isn't present,
+// or that the node didn't record.
+function sensor(present, v, missing) {
+	return present && v !== missing ? v : null;
+}
+
+function datetime(b, i) {
+	return u16(b, i) + "-" + pad(b[i + 2]) + "-" + pad(b[i + 3]) + "T" +
+		pad(b[i + 4]) + ":" + pad(b[i + 5]) + ":" + pad(b[i + 6]) + "Z";
+}
+`
+
+const jsEntryPoints = `
+function decode(bytes) {
+	var layout = layouts[bytes.length];
+	if (!layout) {
+		return null;
+	}
+	return layout(bytes);
+}
+
+// Decoder is the TTN v2 payload function.
+function Decoder(bytes, port) {
+	return decode(bytes) || {};
+}
+
+// decodeUplink is the TTN v3 and ChirpStack v4 codec.
+function decodeUplink(input) {
+	var data = decode(input.bytes);
+	if (!data) {
+		return {errors: ["unknown payload length " + input.bytes.length]};
+	}
+	return {data: data};
+}
+`
+
+var jsReaders = map[string]string{
+	schema.Uint16:   "u16",
+	schema.Uint32:   "u32",
+	schema.Int32:    "i32",
+	schema.Float32:  "f32",
+	schema.DateTime: "datetime",
+}
+
+func jsValue(f schema.Field, off int) string {
+	var v string
+	switch f.Type {
+	case schema.Uint8:
+		v = fmt.Sprintf("b[%d]", off)
+	case schema.Bool:
+		v = fmt.Sprintf("b[%d] === 1", off)
+	default:
+		v = fmt.Sprintf("%s(b, %d)", jsReaders[f.Type], off)
+	}
+
+	if f.Scale == 0 || f.Scale == 1 {
+		return v
+	}
+
+	// Dividing keeps 204 * 0.1 from coming out as 20.400000000000002.
+	if inv := 1 / f.Scale; inv == math.Trunc(inv) {
+		return fmt.Sprintf("%s / %v", v, inv)
+	}
+	return fmt.Sprintf("%s * %v", v, f.Scale)
+}
+
+// jsSensorValue is jsValue for fields that depend on a sensor.
+func jsSensorValue(s *schema.Schema, f schema.Field, offsets map[string]int) string {
+	v := jsValue(f, offsets[f.Name])
+	if f.Sensor == "" {
+		return v
+	}
+
+	sensor := s.Sensors[f.Sensor]
+	present := fmt.Sprintf("(b[%d] & %d)", offsets[s.Hardware], sensor.Bit)
+	if sensor.Status != "" {
+		present += fmt.Sprintf(" && b[%d] === 0", offsets[sensor.Status])
+	}
+
+	if f.Missing == nil {
+		return fmt.Sprintf("sensor(%s, %s)", present, v)
+	}
+
+	missing := *f.Missing
+	if f.Scale != 0 {
+		missing *= f.Scale
+	}
+	return fmt.Sprintf("sensor(%s, %s, %v)", present, v, missing)
+}
+
+func genJS(s *schema.Schema, source string) []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "// %s\n//\n", header(source))
+	if s.Comment != "" {
+		fmt.Fprintf(&buf, "// %s\n", s.Comment)
+	}
+	fmt.Fprintf(&buf, "// The layout is picked by the payload's length.\n\n")
+
+	if s.Endian == "big" {
+		buf.WriteString(jsBigEndian)
+	} else {
+		buf.WriteString(jsLittleEndian)
+	}
+	buf.WriteString(jsHelpers)
+
+	fmt.Fprintf(&buf, "\nvar layouts = {\n")
+	for i, v := range s.Versions {
+		fmt.Fprintf(&buf, "\t%d: function (b) {\n\t\treturn {\n", s.Size(v))
+		fmt.Fprintf(&buf, "\t\t\tlayout: %q,\n", s.LayoutName(v))
+
+		fields := s.FieldsFor(v)
+		offsets := s.Offsets(v)
+		for j, f := range fields {
+			sep := ","
+			if j == len(fields)-1 {
+				sep = ""
+			}
+			fmt.Fprintf(&buf, "\t\t\t%s: %s%s\n", f.JSONName(),
+				jsSensorValue(s, f, offsets), sep)
+		}
+
+		sep := ","
+		if i == len(s.Versions)-1 {
+			sep = ""
+		}
+		fmt.Fprintf(&buf, "\t\t};\n\t}%s\n", sep)
+	}
+	fmt.Fprintf(&buf, "};\n")
+
+	buf.WriteString(jsEntryPoints)
+	return buf.Bytes()
+}
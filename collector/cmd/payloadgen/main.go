@@ -0,0 +1,74 @@
+// payloadgen generates the code that handles node payloads from a
+// schema: the reading package's decoder and encoder, the C struct the
+// firmware sends, a JavaScript payload formatter for TTN and
+// ChirpStack, and the struct formats for the Python scripts.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/kisom/redenv/collector/schema"
+)
+
+func header(source string) string {
+	return fmt.Sprintf("Code generated by payloadgen from %s; DO NOT EDIT.", source)
+}
+
+func main() {
+	var schemaFile, goFile, cFiles, jsFile, pyFile string
+	flag.StringVar(&schemaFile, "schema", "", "`path` to the payload schema")
+	flag.StringVar(&goFile, "go", "", "write the Go decoder to `path`")
+	flag.StringVar(&cFiles, "c", "", "comma-separated `paths` to write the C header to")
+	flag.StringVar(&jsFile, "js", "", "write the JavaScript payload formatter to `path`")
+	flag.StringVar(&pyFile, "py", "", "write the Python struct formats to `path`")
+	flag.Parse()
+
+	if schemaFile == "" {
+		log.Fatal("payloadgen: no schema given")
+	}
+
+	s, err := schema.Load(schemaFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	source := filepath.Base(schemaFile)
+
+	if goFile != "" {
+		out, err := genGo(s, source)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err = ioutil.WriteFile(goFile, out, 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if cFiles != "" {
+		out := genC(s, source)
+		for _, path := range strings.Split(cFiles, ",") {
+			if err = ioutil.WriteFile(path, out, 0644); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	if jsFile != "" {
+		out := genJS(s, source)
+		if err = ioutil.WriteFile(jsFile, out, 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if pyFile != "" {
+		out := genPython(s, source)
+		if err = ioutil.WriteFile(pyFile, out, 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
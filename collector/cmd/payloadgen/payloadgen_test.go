@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/kisom/goutils/assert"
+	"github.com/kisom/redenv/collector/schema"
+)
+
+// TestGenerated checks that the checked in files match the schema;
+// if it fails, run go generate in the reading package.
+func TestGenerated(t *testing.T) {
+	s, err := schema.Load("../../schema/redenv.json")
+	assert.NoErrorT(t, err)
+
+	goSrc, err := genGo(s, "redenv.json")
+	assert.NoErrorT(t, err)
+
+	generated := map[string][]byte{
+		"../../reading/payload_gen.go":     goSrc,
+		"../../../redenv/reading.h":        genC(s, "redenv.json"),
+		"../../../node/include/reading.h":  genC(s, "redenv.json"),
+		"../../schema/redenv.js":           genJS(s, "redenv.json"),
+		"../../../script/redenv_layout.py": genPython(s, "redenv.json"),
+	}
+
+	for path, want := range generated {
+		have, err := ioutil.ReadFile(path)
+		assert.NoErrorT(t, err)
+		assert.BoolT(t, bytes.Equal(have, want), path+" is out of date")
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/kisom/redenv/collector/schema"
+)
+
+var pythonTypes = map[string]string{
+	schema.Uint8:    "B",
+	schema.Uint16:   "H",
+	schema.Uint32:   "I",
+	schema.Int32:    "i",
+	schema.Float32:  "f",
+	schema.Bool:     "B",
+	schema.DateTime: "HBBBBB",
+}
+
+// pythonFormat returns the Python struct format for a version.
+func pythonFormat(s *schema.Schema, v int) string {
+	format := "<"
+	if s.Endian == "big" {
+		format = ">"
+	}
+
+	for _, f := range s.FieldsFor(v) {
+		format += pythonTypes[f.Type]
+	}
+	return format
+}
+
+// genPython emits a Python module with the struct format and size of
+// each version, for the scripts that unpack readings.
+func genPython(s *schema.Schema, source string) []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "\"\"\"\n%s\n", header(source))
+	if s.Comment != "" {
+		fmt.Fprintf(&buf, "\n%s\n", s.Comment)
+	}
+	fmt.Fprintf(&buf, "\"\"\"\n\nimport struct\n\n")
+
+	fmt.Fprintf(&buf, "CURRENT = %d\n\n", s.Current())
+	fmt.Fprintf(&buf, "# The struct format of each version.\nFORMATS = {\n")
+	for _, v := range s.Versions {
+		fmt.Fprintf(&buf, "    %d: \"%s\",\n", v, pythonFormat(s, v))
+	}
+	fmt.Fprintf(&buf, "}\n\n# The size of each version, in bytes.\nSIZES = {\n")
+	for _, v := range s.Versions {
+		fmt.Fprintf(&buf, "    %d: %d,\n", v, s.Size(v))
+	}
+	fmt.Fprintf(&buf, "}\n\n")
+
+	fmt.Fprintf(&buf, `
+def unpack(data):
+    """Unpack a reading, telling its version from its size."""
+    for version, size in SIZES.items():
+        if len(data) == size:
+            return struct.unpack(FORMATS[version], data)
+    raise ValueError(f"a {len(data)}-byte payload isn't a known reading")
+`)
+	return buf.Bytes()
+}
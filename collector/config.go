@@ -3,23 +3,43 @@ package main
 import (
 	"errors"
 	"fmt"
+	"log"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gokyle/goconfig"
+	"github.com/kisom/redenv/collector/reading"
 )
 
+// DefaultAuthHeader is the header webhooks are expected to send the
+// auth key in.
+const DefaultAuthHeader = "Authorization"
+
 type TTN struct {
-	app_id     string
-	access_key string
-	auth_key   string
+	app_id      string
+	access_key  string
+	auth_keys   []string
+	auth_header string
 }
 
+// TTNFromMap loads the ttn section. auth_key may list several keys
+// separated by commas, so that keys can be rotated.
 func TTNFromMap(cfg map[string]string) (TTN, error) {
-	ttn := TTN{}
+	ttn := TTN{auth_header: DefaultAuthHeader}
 
 	ttn.app_id = cfg["app_id"]
 	ttn.access_key = cfg["access_key"]
-	ttn.auth_key = cfg["auth_key"]
+	for _, key := range strings.Split(cfg["auth_key"], ",") {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			ttn.auth_keys = append(ttn.auth_keys, key)
+		}
+	}
+
+	if header, ok := cfg["auth_header"]; ok && header != "" {
+		ttn.auth_header = header
+	}
 
 	return ttn, ttn.Validate()
 }
@@ -37,18 +57,32 @@ func (ttn TTN) Validate() error {
 		return missing("access_key")
 	}
 
-	if ttn.auth_key == "" {
+	if len(ttn.auth_keys) == 0 {
 		return missing("auth_key")
 	}
 
 	return nil
 }
 
-func (ttn TTN) AppID() string     { return ttn.app_id }
-func (ttn TTN) AccessKey() string { return ttn.access_key }
-func (ttn TTN) AuthKey() string   { return ttn.auth_key }
+func (ttn TTN) AppID() string      { return ttn.app_id }
+func (ttn TTN) AccessKey() string  { return ttn.access_key }
+func (ttn TTN) AuthKeys() []string { return ttn.auth_keys }
+func (ttn TTN) AuthHeader() string { return ttn.auth_header }
 
+// Database backends.
+const (
+	BackendPostgres = "postgres"
+	BackendSQLite   = "sqlite"
+	BackendMemory   = "memory"
+)
+
+// Database selects where uplinks and readings are stored. The backend
+// is postgres unless it says otherwise; sqlite needs the path to the
+// database file, and memory keeps everything until the collector
+// exits.
 type Database struct {
+	backend  string
+	path     string
 	user     string
 	password string
 	host     string
@@ -61,6 +95,19 @@ func (db Database) Validate() error {
 		return fmt.Errorf("collector: database config is missing %s", v)
 	}
 
+	switch db.backend {
+	case BackendPostgres:
+	case BackendSQLite:
+		if db.path == "" {
+			return missing("path")
+		}
+		return nil
+	case BackendMemory:
+		return nil
+	default:
+		return fmt.Errorf("collector: unknown database backend %s", db.backend)
+	}
+
 	if db.user == "" {
 		return missing("user")
 	}
@@ -87,7 +134,11 @@ func (db Database) Validate() error {
 func DatabaseFromMap(cfg map[string]string) (Database, error) {
 	var err error
 
-	db := Database{port: 5432}
+	db := Database{backend: BackendPostgres, port: 5432}
+	if backend, ok := cfg["backend"]; ok {
+		db.backend = backend
+	}
+	db.path = cfg["path"]
 	db.user = cfg["user"]
 	db.password = cfg["password"]
 	db.host = cfg["host"]
@@ -103,6 +154,8 @@ func DatabaseFromMap(cfg map[string]string) (Database, error) {
 	return db, err
 }
 
+func (db Database) Backend() string  { return db.backend }
+func (db Database) Path() string     { return db.path }
 func (db Database) User() string     { return db.user }
 func (db Database) Password() string { return db.password }
 func (db Database) Host() string     { return db.host }
@@ -114,13 +167,158 @@ func (db Database) ConnStr() string {
 		db.user, db.password, db.host, db.port, db.name)
 }
 
+// LoRaWAN configures decoding of raw frames received from packet
+// forwarders. It is optional.
+type LoRaWAN struct {
+	sessions string
+	net_id   uint32
+}
+
+func LoRaWANFromMap(cfg map[string]string) (LoRaWAN, error) {
+	lw := LoRaWAN{}
+	lw.sessions = cfg["sessions"]
+
+	if netID, ok := cfg["net_id"]; ok {
+		n, err := strconv.ParseUint(netID, 16, 24)
+		if err != nil {
+			return lw, fmt.Errorf("collector: invalid lorawan net_id %s", netID)
+		}
+		lw.net_id = uint32(n)
+	}
+
+	return lw, nil
+}
+
+// Sessions is the path to the file of OTAA devices and ABP-style
+// sessions.
+func (lw LoRaWAN) Sessions() string { return lw.sessions }
+
+// NetID is the network identifier handed out in join accepts.
+func (lw LoRaWAN) NetID() uint32 { return lw.net_id }
+
+// Decoders points at a file of payload decoders to register at
+// startup; see reading.ParseDecoders. It is optional.
+type Decoders struct {
+	file string
+}
+
+func DecodersFromMap(cfg map[string]string) (Decoders, error) {
+	d := Decoders{file: cfg["file"]}
+	if d.file == "" {
+		return d, errors.New("collector: decoders config is missing file")
+	}
+	return d, nil
+}
+
+// File is the path to the decoder file, or empty if there isn't one.
+func (d Decoders) File() string { return d.file }
+
+// Spool keeps uplinks on disk while the database can't be written to,
+// so that they can be stored once it's back. It is optional.
+type Spool struct {
+	dir string
+}
+
+func SpoolFromMap(cfg map[string]string) (Spool, error) {
+	sp := Spool{dir: cfg["dir"]}
+	if sp.dir == "" {
+		return sp, errors.New("collector: spool config is missing dir")
+	}
+	return sp, nil
+}
+
+// Dir is the directory the spool is kept in, or empty if uplinks
+// aren't spooled.
+func (sp Spool) Dir() string { return sp.dir }
+
+// Device holds the settings for one device, from a section named
+// device_<id>. Section names may only hold letters, digits and
+// underscores, so id overrides the device ID taken from the name.
+type Device struct {
+	id        string
+	elevation *float64
+	timezone  *time.Location
+}
+
+func DeviceFromMap(id string, cfg map[string]string) (Device, error) {
+	dev := Device{id: id}
+	if name, ok := cfg["id"]; ok && name != "" {
+		dev.id = name
+	}
+
+	if elevation, ok := cfg["elevation"]; ok {
+		v, err := strconv.ParseFloat(elevation, 64)
+		if err != nil {
+			return dev, fmt.Errorf("collector: invalid elevation %s for device %s",
+				elevation, dev.id)
+		}
+		dev.elevation = &v
+	}
+
+	if name, ok := cfg["timezone"]; ok && name != "" {
+		dev.timezone = loadTimezone(name)
+	}
+
+	return dev, nil
+}
+
+func (dev Device) ID() string { return dev.id }
+
+// Elevation is the device's height above sea level in metres, or nil
+// if it isn't configured.
+func (dev Device) Elevation() *float64 { return dev.elevation }
+
+// Timezone is the zone the device's readings are displayed in, or nil
+// to use the global one.
+func (dev Device) Timezone() *time.Location { return dev.timezone }
+
+// Apply fills in the parts of a reading that come from the device's
+// configuration.
+func (dev Device) Apply(r *reading.Reading) {
+	r.Elevation = dev.elevation
+}
+
+const deviceSectionPrefix = "device_"
+
+// defaultTimezone is the zone readings are displayed in if the config
+// doesn't set one.
+const defaultTimezone = "America/Los_Angeles"
+
+// loadTimezone looks up a timezone, falling back to UTC if it can't be
+// found; minimal images often don't ship tzdata.
+func loadTimezone(name string) *time.Location {
+	loc, err := reading.LoadTimezone(name)
+	if err != nil {
+		log.Printf("[ERROR] timezone %s: %s; using UTC", name, err)
+	}
+	return loc
+}
+
 type Config struct {
 	TTN      TTN
 	Database Database
+	LoRaWAN  LoRaWAN
+	Decoders Decoders
+	Spool    Spool
+	Devices  map[string]Device
+
+	// Timezone is the zone readings are displayed in, from the
+	// timezone key at the top of the file. It defaults to
+	// America/Los_Angeles.
+	Timezone *time.Location
+}
+
+// Device returns the settings for a device; devices without a section
+// get the defaults.
+func (cfg *Config) Device(id string) Device {
+	if dev, ok := cfg.Devices[id]; ok {
+		return dev
+	}
+	return Device{id: id}
 }
 
 func LoadConfig(path string) (*Config, error) {
-	config := &Config{}
+	config := &Config{Devices: map[string]Device{}}
 
 	cfgMap, err := goconfig.ParseFile(path)
 	if err != nil {
@@ -145,5 +343,44 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
+	if cfgMap.SectionInConfig("lorawan") {
+		config.LoRaWAN, err = LoRaWANFromMap(cfgMap["lorawan"])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfgMap.SectionInConfig("decoders") {
+		config.Decoders, err = DecodersFromMap(cfgMap["decoders"])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfgMap.SectionInConfig("spool") {
+		config.Spool, err = SpoolFromMap(cfgMap["spool"])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	name := cfgMap[goconfig.DefaultSection]["timezone"]
+	if name == "" {
+		name = defaultTimezone
+	}
+	config.Timezone = loadTimezone(name)
+
+	for section, values := range cfgMap {
+		if !strings.HasPrefix(section, deviceSectionPrefix) {
+			continue
+		}
+
+		dev, err := DeviceFromMap(strings.TrimPrefix(section, deviceSectionPrefix), values)
+		if err != nil {
+			return nil, err
+		}
+		config.Devices[dev.ID()] = dev
+	}
+
 	return config, nil
 }
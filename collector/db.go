@@ -1,84 +1,75 @@
 package main
 
 import (
-	"database/sql"
+	"errors"
+	"fmt"
 
-	"github.com/google/uuid"
-	"github.com/kisom/redenv/collector/reading"
-	"github.com/kisom/redenv/collector/ttn"
+	"github.com/kisom/redenv/collector/lorawan"
+	"github.com/kisom/redenv/collector/storage"
 )
 
-var (
-	insertReading = `INSERT INTO readings (
-	received_at,
-	device,
-	uplink,
-	recorded_at,
-	hardware,
-	uptime,
-	temperature,
-	temperature_cal,
-	temperature_is_cal,
-	humidity,
-	pressure,
-	ccs811_status,
-	co2,
-	tvoc,
-	voltage,
-	fix,
-	sats
-) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`
-	insertUplink = `INSERT INTO uplinks (
-	id,
-	app_id,
-	dev_id,
-	hw_serial,
-	port,
-	counter,
-	is_retry,
-	is_confirmed,
-	payload_raw,
-	uplink_time,
-	frequency,
-	modulation,
-	data_rate,
-	bit_rate
-) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`
-)
-
-func StoreUplink(db *sql.DB, r *reading.Reading, u *ttn.Uplink) error {
-	id, err := uuid.NewRandom()
-	if err != nil {
-		return err
+// openSQL opens the SQL database selected in the config without
+// checking its schema.
+func openSQL(cfg Database) (*storage.SQLStore, error) {
+	switch cfg.Backend() {
+	case BackendPostgres:
+		return storage.OpenPostgres(cfg.ConnStr())
+	case BackendSQLite:
+		return storage.OpenSQLite(cfg.Path())
+	case BackendMemory:
+		return nil, errors.New("collector: the memory backend has no schema")
+	default:
+		return nil, fmt.Errorf("collector: unknown database backend %s", cfg.Backend())
 	}
+}
 
-	r.Uplink = id.String()
+// openStore opens the database backend selected in the config. SQL
+// databases must have the schema this collector was built with.
+func openStore(cfg Database) (storage.Store, error) {
+	if cfg.Backend() == BackendMemory {
+		return storage.NewMemory(), nil
+	}
 
-	tx, err := db.Begin()
+	s, err := openSQL(cfg)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = tx.Exec(insertUplink, id.String(), u.AppID, u.DevID, u.HardwareSerial,
-		u.Port, u.Counter, u.IsRetry, u.Confirmed, u.PayloadRaw,
-		r.ReceivedAt.Unix(), u.Metadata.Frequency, u.Metadata.Modulation,
-		u.Metadata.DataRate, u.Metadata.BitRate)
-	if err != nil {
-		// TODO: Could be a doule error, but not worth figuring out right now.
-		tx.Rollback()
-		return err
+	if err = s.CheckSchema(); err != nil {
+		s.Close()
+		return nil, err
 	}
+	return s, nil
+}
 
-	_, err = tx.Exec(insertReading, r.ReceivedAt.Unix(), r.Device, r.Uplink,
-		r.When.Unix(), r.Hardware, r.Uptime,
-		r.Temperature, r.TemperatureCalibration, r.TemperatureCalibrated,
-		r.Humidity, r.Pressure,
-		r.CCS811Status, r.CO2, r.TVOC, r.Voltage, r.Fix, r.Sats)
-	if err != nil {
-		// TODO: Could be a doule error, but not worth figuring out right now.
-		tx.Rollback()
-		return err
+// dbKeyStore keeps LoRaWAN sessions created by the join server in
+// the database. Sessions that aren't found there are looked up in the
+// static store loaded from the session file.
+type dbKeyStore struct {
+	store  storage.Store
+	static *lorawan.MemoryKeyStore
+}
+
+func (ks *dbKeyStore) Session(addr lorawan.DevAddr) (*lorawan.Session, error) {
+	s, err := ks.store.Session(addr)
+	if err == lorawan.ErrUnknownDevice {
+		return ks.static.Session(addr)
+	}
+	return s, err
+}
+
+func (ks *dbKeyStore) UpdateSession(s *lorawan.Session) error {
+	err := ks.store.UpdateSession(s)
+	if err == lorawan.ErrUnknownDevice {
+		return ks.static.UpdateSession(s)
 	}
+	return err
+}
+
+func (ks *dbKeyStore) UseDevNonce(devEUI lorawan.EUI64, nonce uint16) error {
+	return ks.store.UseDevNonce(devEUI, nonce)
+}
 
-	return tx.Commit()
+func (ks *dbKeyStore) SaveSession(s *lorawan.Session) error {
+	return ks.store.SaveSession(s)
 }
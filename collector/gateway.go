@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/base64"
+	"log"
+	"time"
+
+	"github.com/kisom/redenv/collector/lorawan"
+	"github.com/kisom/redenv/collector/reading"
+	"github.com/kisom/redenv/collector/semtech"
+	"github.com/kisom/redenv/collector/storage"
+	"github.com/kisom/redenv/collector/ttn"
+)
+
+var (
+	forwarder  *semtech.Server
+	keyStore   lorawan.KeyStore
+	joinServer *lorawan.JoinServer
+)
+
+// gatewayMessage is an uplink received from a packet forwarder and
+// decrypted locally.
+type gatewayMessage struct {
+	gw semtech.EUI
+	rx *semtech.RXPK
+	up *lorawan.Uplink
+}
+
+func (m *gatewayMessage) Uplink() *ttn.Uplink {
+	s := m.up.Session
+	u := &ttn.Uplink{
+		AppID:          s.AppID,
+		DevID:          s.DeviceID,
+		HardwareSerial: s.DevEUI,
+		Port:           m.up.Port,
+		Counter:        int(m.up.FCnt),
+		Confirmed:      m.up.Frame.Confirmed(),
+		PayloadRaw:     base64.StdEncoding.EncodeToString(m.up.Payload),
+		Metadata: ttn.Metadata{
+			Time:       m.rx.Time,
+			Frequency:  ttn.Number(m.rx.Freq),
+			Modulation: ttn.Text(m.rx.Modu),
+			CodingRate: ttn.Text(m.rx.Codr),
+			Gateways: []ttn.Gateway{{
+				GatewayID: m.gw.String(),
+				Timestamp: m.rx.Tmst,
+				Time:      m.rx.Time,
+				Channel:   m.rx.Chan,
+				RSSI:      float32(m.rx.RSSI),
+				SNR:       m.rx.LSNR,
+				RFChain:   m.rx.RFCh,
+			}},
+		},
+	}
+
+	if u.AppID == "" {
+		u.AppID = config.TTN.AppID()
+	}
+
+	if u.HardwareSerial == "" {
+		u.HardwareSerial = s.DevAddr.String()
+	}
+
+	if u.Metadata.Time == "" {
+		// The gateway only sets the time if it has a GPS fix.
+		u.Metadata.Time = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	if m.rx.Modu == "FSK" {
+		u.Metadata.BitRate = ttn.Text(m.rx.Datr)
+	} else {
+		u.Metadata.DataRate = ttn.Text(m.rx.Datr)
+	}
+
+	return u
+}
+
+func (m *gatewayMessage) ToReading() (*reading.Reading, error) {
+	return m.Uplink().ToReading()
+}
+
+// gatewayJoin answers a join request, queueing the join accept for
+// the device's first receive window on the gateway that heard it.
+func gatewayJoin(gw semtech.EUI, rx *semtech.RXPK, phy []byte) error {
+	s, accept, err := joinServer.Join(phy)
+	if err != nil {
+		return err
+	}
+
+	freq, datr, err := lorawan.US915RX1(rx.Freq, rx.Datr)
+	if err != nil {
+		return err
+	}
+
+	err = forwarder.Send(gw, &semtech.TXPK{
+		Tmst: rx.Tmst + lorawan.JoinAcceptDelay1,
+		Freq: freq,
+		Powe: lorawan.US915DownlinkPower,
+		Modu: "LORA",
+		Datr: datr,
+		Codr: "4/5",
+		IPol: true,
+		Size: len(accept),
+		Data: base64.StdEncoding.EncodeToString(accept),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Until the accept has been queued, the device may still be
+	// using its old session.
+	if err = joinServer.Activate(s); err != nil {
+		return err
+	}
+
+	log.Printf("%s (%s) joined as %s", s.DeviceID, s.DevEUI, s.DevAddr)
+	return nil
+}
+
+// addReception records another gateway's reception of a frame that
+// has already been ingested.
+func addReception(msg *gatewayMessage) {
+	u := msg.Uplink()
+	receivedAt, err := time.Parse(time.RFC3339, u.Metadata.Time)
+	if err != nil {
+		receivedAt = time.Now()
+	}
+
+	err = store.AddReceptions(u, receivedAt)
+	if err == storage.ErrNotFound {
+		// The first reception was spooled, so there's nothing to
+		// add this one to yet.
+		log.Printf("uplink %d from %s via gateway %s isn't stored; reception not recorded",
+			u.Counter, u.DevID, msg.gw)
+		return
+	} else if err != nil {
+		log.Printf("[ERROR] recording reception via gateway %s: %s", msg.gw, err)
+		return
+	}
+
+	log.Printf("uplink %d from %s also heard by gateway %s", u.Counter, u.DevID, msg.gw)
+}
+
+// gatewayQueueSize is how many frames can wait to be stored before
+// frames from the packet forwarders are dropped.
+const gatewayQueueSize = 1024
+
+// A gatewayFrame is a data frame waiting for the gateway worker.
+type gatewayFrame struct {
+	gw  semtech.EUI
+	rx  *semtech.RXPK
+	phy []byte
+}
+
+// gatewayFrames holds the data frames received from the packet
+// forwarders until the gateway worker gets to them.
+var gatewayFrames = make(chan *gatewayFrame, gatewayQueueSize)
+
+// gatewayUplink receives uplinks from the packet forwarder listener.
+// It's called from the listener's read loop, so nothing it does waits
+// on the database: a slow store would hold up the acknowledgements to
+// every gateway. Join requests are answered on their own goroutine
+// rather than behind the queued frames, so that the accept makes the
+// device's receive window; data frames are queued for the gateway
+// worker.
+func gatewayUplink(gw semtech.EUI, rx *semtech.RXPK, phy []byte) {
+	if len(phy) > 0 && lorawan.MHDR(phy[0]).MType() == lorawan.JoinRequest {
+		go func() {
+			if err := gatewayJoin(gw, rx, phy); err != nil {
+				log.Printf("[ERROR] join request via gateway %s: %s", gw, err)
+			}
+		}()
+		return
+	}
+
+	select {
+	case gatewayFrames <- &gatewayFrame{gw: gw, rx: rx, phy: phy}:
+	default:
+		log.Printf("[ERROR] frame via gateway %s dropped: %d frames are waiting to be stored",
+			gw, len(gatewayFrames))
+	}
+}
+
+// gatewayWorker decodes and stores the queued data frames in the order
+// they were received, so that frame counters and repeats are checked
+// against the frames before them.
+func gatewayWorker() {
+	for f := range gatewayFrames {
+		gatewayFrameIn(f.gw, f.rx, f.phy)
+	}
+}
+
+// gatewayFrameIn decodes a data frame and stores its uplink.
+func gatewayFrameIn(gw semtech.EUI, rx *semtech.RXPK, phy []byte) {
+	up, err := lorawan.DecodeUplink(keyStore, phy)
+	if err != nil {
+		log.Printf("[ERROR] frame via gateway %s: %s", gw, err)
+		return
+	}
+
+	if up.Port <= 0 {
+		log.Printf("%s sent a frame with no application payload", up.Session.DeviceID)
+		return
+	}
+
+	msg := &gatewayMessage{gw: gw, rx: rx, up: up}
+	if up.Repeat {
+		addReception(msg)
+		return
+	}
+
+	// Duplicates are counted by the store, and decoding errors have
+	// been logged.
+	err = ingest(msg)
+	if err != nil && err != storage.ErrDuplicate && err != errUndecoded {
+		log.Printf("[ERROR] %s", err)
+	}
+}
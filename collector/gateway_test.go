@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/kisom/goutils/assert"
+	"github.com/kisom/redenv/collector/lorawan"
+	"github.com/kisom/redenv/collector/semtech"
+)
+
+func TestGatewayUplinkQueue(t *testing.T) {
+	queue := gatewayFrames
+	gatewayFrames = make(chan *gatewayFrame, 1)
+	defer func() { gatewayFrames = queue }()
+
+	// The read loop mustn't wait for the worker, even when the
+	// queue is full.
+	phy := []byte{byte(lorawan.UnconfirmedDataUp << 5), 1, 2, 3}
+	rx := &semtech.RXPK{}
+	gatewayUplink(semtech.EUI{1}, rx, phy)
+	gatewayUplink(semtech.EUI{2}, rx, phy)
+	assert.BoolT(t, len(gatewayFrames) == 1, "one frame queued")
+
+	f := <-gatewayFrames
+	assert.BoolT(t, f.gw == semtech.EUI{1}, "first frame kept")
+}
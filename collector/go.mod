@@ -1,10 +1,11 @@
 module github.com/kisom/redenv/collector
 
-go 1.13
+go 1.16
 
 require (
 	github.com/gokyle/goconfig v0.0.0-20150908043511-373746557f7f
 	github.com/google/uuid v1.1.1
 	github.com/kisom/goutils v1.3.0
 	github.com/lib/pq v1.2.0
+	github.com/mattn/go-sqlite3 v1.14.16
 )
@@ -0,0 +1,69 @@
+package lorawan
+
+import (
+	"crypto/aes"
+)
+
+// xor sets dst[i] = a[i] ^ b[i].
+func xor(dst, a, b []byte) {
+	for i := range dst {
+		dst[i] = a[i] ^ b[i]
+	}
+}
+
+// cmacShift doubles a block in GF(2^128), as used to derive the CMAC
+// subkeys.
+func cmacShift(b []byte) []byte {
+	out := make([]byte, len(b))
+	var carry byte
+	for i := len(b) - 1; i >= 0; i-- {
+		out[i] = b[i]<<1 | carry
+		carry = b[i] >> 7
+	}
+
+	if b[0]&0x80 != 0 {
+		out[len(out)-1] ^= 0x87
+	}
+	return out
+}
+
+// aesCMAC computes the AES-CMAC (RFC 4493) of msg.
+func aesCMAC(key [16]byte, msg []byte) [16]byte {
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		// A 16-byte key can't be rejected.
+		panic(err)
+	}
+
+	l := make([]byte, aes.BlockSize)
+	block.Encrypt(l, l)
+	k1 := cmacShift(l)
+	k2 := cmacShift(k1)
+
+	n := (len(msg) + aes.BlockSize - 1) / aes.BlockSize
+	complete := n > 0 && len(msg)%aes.BlockSize == 0
+	if n == 0 {
+		n = 1
+	}
+
+	last := make([]byte, aes.BlockSize)
+	if complete {
+		copy(last, msg[(n-1)*aes.BlockSize:])
+		xor(last, last, k1)
+	} else {
+		rem := msg[(n-1)*aes.BlockSize:]
+		copy(last, rem)
+		last[len(rem)] = 0x80
+		xor(last, last, k2)
+	}
+
+	var x [16]byte
+	for i := 0; i < n-1; i++ {
+		xor(x[:], x[:], msg[i*aes.BlockSize:(i+1)*aes.BlockSize])
+		block.Encrypt(x[:], x[:])
+	}
+
+	xor(x[:], x[:], last)
+	block.Encrypt(x[:], x[:])
+	return x
+}
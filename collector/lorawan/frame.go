@@ -0,0 +1,234 @@
+// Package lorawan decodes LoRaWAN 1.0.x frames received directly from
+// a gateway: it checks their integrity with the network session key
+// and decrypts the application payload.
+package lorawan
+
+import (
+	"crypto/aes"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type MType uint8
+
+const (
+	JoinRequest MType = iota
+	JoinAccept
+	UnconfirmedDataUp
+	UnconfirmedDataDown
+	ConfirmedDataUp
+	ConfirmedDataDown
+	RejoinRequest
+	Proprietary
+)
+
+func (t MType) String() string {
+	switch t {
+	case JoinRequest:
+		return "JoinRequest"
+	case JoinAccept:
+		return "JoinAccept"
+	case UnconfirmedDataUp:
+		return "UnconfirmedDataUp"
+	case UnconfirmedDataDown:
+		return "UnconfirmedDataDown"
+	case ConfirmedDataUp:
+		return "ConfirmedDataUp"
+	case ConfirmedDataDown:
+		return "ConfirmedDataDown"
+	case RejoinRequest:
+		return "RejoinRequest"
+	default:
+		return "Proprietary"
+	}
+}
+
+// Uplink returns true if frames of this type are sent by devices.
+func (t MType) Uplink() bool {
+	return t == JoinRequest || t == UnconfirmedDataUp ||
+		t == ConfirmedDataUp || t == RejoinRequest
+}
+
+// MajorLoRaWANR1 is the only major version defined by the spec.
+const MajorLoRaWANR1 = 0
+
+// MHDR is the MAC header that starts every frame.
+type MHDR uint8
+
+func (h MHDR) MType() MType { return MType(h >> 5) }
+func (h MHDR) Major() uint8 { return uint8(h) & 0x03 }
+
+var (
+	ErrShortFrame   = errors.New("lorawan: frame is too short")
+	ErrMajorVersion = errors.New("lorawan: unsupported major version")
+	ErrNotDataFrame = errors.New("lorawan: not a data frame")
+	ErrMIC          = errors.New("lorawan: MIC verification failed")
+)
+
+// DevAddr is a device's network address. It is held in the usual
+// big-endian display order; on the air it is little-endian.
+type DevAddr [4]byte
+
+func (a DevAddr) String() string {
+	return strings.ToUpper(hex.EncodeToString(a[:]))
+}
+
+// ParseDevAddr parses a hex device address. Leading zeros may be
+// omitted, as they are when the firmware prints it.
+func ParseDevAddr(s string) (DevAddr, error) {
+	var a DevAddr
+	if len(s) > 8 {
+		return a, fmt.Errorf("lorawan: invalid device address %q", s)
+	}
+
+	b, err := hex.DecodeString(strings.Repeat("0", 8-len(s)) + s)
+	if err != nil {
+		return a, fmt.Errorf("lorawan: invalid device address %q", s)
+	}
+
+	copy(a[:], b)
+	return a, nil
+}
+
+func (a DevAddr) uint32() uint32 {
+	return binary.BigEndian.Uint32(a[:])
+}
+
+// FCtrl bits for uplinks.
+const (
+	FCtrlADR       = 0x80
+	FCtrlADRACKReq = 0x40
+	FCtrlACK       = 0x20
+	FCtrlClassB    = 0x10
+	fctrlFOptsLen  = 0x0f
+)
+
+// DataFrame is a parsed data message. FRMPayload is still encrypted
+// until passed through a Session.
+type DataFrame struct {
+	MHDR       MHDR
+	DevAddr    DevAddr
+	FCtrl      uint8
+	FCnt       uint16
+	FOpts      []byte
+	FPort      *uint8
+	FRMPayload []byte
+	MIC        [4]byte
+
+	// raw is the part of the frame that the MIC covers.
+	raw []byte
+}
+
+// Confirmed returns true if the device asked for an acknowledgement.
+func (f *DataFrame) Confirmed() bool {
+	mtype := f.MHDR.MType()
+	return mtype == ConfirmedDataUp || mtype == ConfirmedDataDown
+}
+
+// ParseDataFrame parses a data up- or downlink PHYPayload.
+func ParseDataFrame(phy []byte) (*DataFrame, error) {
+	// MHDR + DevAddr + FCtrl + FCnt + MIC
+	if len(phy) < 12 {
+		return nil, ErrShortFrame
+	}
+
+	f := &DataFrame{MHDR: MHDR(phy[0])}
+	switch f.MHDR.MType() {
+	case UnconfirmedDataUp, UnconfirmedDataDown, ConfirmedDataUp, ConfirmedDataDown:
+	default:
+		return nil, ErrNotDataFrame
+	}
+
+	if f.MHDR.Major() != MajorLoRaWANR1 {
+		return nil, ErrMajorVersion
+	}
+
+	f.raw = phy[:len(phy)-4]
+	copy(f.MIC[:], phy[len(phy)-4:])
+
+	mac := f.raw[1:]
+	binary.BigEndian.PutUint32(f.DevAddr[:], binary.LittleEndian.Uint32(mac))
+	f.FCtrl = mac[4]
+	f.FCnt = binary.LittleEndian.Uint16(mac[5:])
+	mac = mac[7:]
+
+	foptsLen := int(f.FCtrl & fctrlFOptsLen)
+	if len(mac) < foptsLen {
+		return nil, ErrShortFrame
+	}
+
+	if foptsLen > 0 {
+		f.FOpts = mac[:foptsLen]
+	}
+	mac = mac[foptsLen:]
+
+	if len(mac) > 0 {
+		port := mac[0]
+		f.FPort = &port
+		f.FRMPayload = mac[1:]
+	}
+
+	return f, nil
+}
+
+func (f *DataFrame) dir() byte {
+	if f.MHDR.MType().Uplink() {
+		return 0
+	}
+	return 1
+}
+
+// mic computes the frame's MIC for the full 32-bit frame counter.
+func (f *DataFrame) mic(key [16]byte, fcnt uint32) [4]byte {
+	b0 := make([]byte, 16, 16+len(f.raw))
+	b0[0] = 0x49
+	b0[5] = f.dir()
+	binary.LittleEndian.PutUint32(b0[6:], f.DevAddr.uint32())
+	binary.LittleEndian.PutUint32(b0[10:], fcnt)
+	b0[15] = byte(len(f.raw))
+
+	var mic [4]byte
+	full := aesCMAC(key, append(b0, f.raw...))
+	copy(mic[:], full[:])
+	return mic
+}
+
+// VerifyMIC checks the frame against the network session key.
+func (f *DataFrame) VerifyMIC(nwkSKey [16]byte, fcnt uint32) bool {
+	mic := f.mic(nwkSKey, fcnt)
+	return subtle.ConstantTimeCompare(mic[:], f.MIC[:]) == 1
+}
+
+// cryptPayload encrypts or decrypts an FRMPayload; the operation is
+// its own inverse.
+func cryptPayload(key [16]byte, dir byte, addr DevAddr, fcnt uint32, data []byte) []byte {
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		panic(err)
+	}
+
+	out := make([]byte, len(data))
+	a := make([]byte, aes.BlockSize)
+	s := make([]byte, aes.BlockSize)
+	a[0] = 0x01
+	a[5] = dir
+	binary.LittleEndian.PutUint32(a[6:], addr.uint32())
+	binary.LittleEndian.PutUint32(a[10:], fcnt)
+
+	for i := 0; i < len(data); i += aes.BlockSize {
+		a[15] = byte(i/aes.BlockSize + 1)
+		block.Encrypt(s, a)
+
+		end := i + aes.BlockSize
+		if end > len(data) {
+			end = len(data)
+		}
+		xor(out[i:end], data[i:end], s)
+	}
+
+	return out
+}
@@ -0,0 +1,115 @@
+package lorawan
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/kisom/goutils/assert"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	assert.NoErrorT(t, err)
+	return b
+}
+
+// Test vectors from RFC 4493, section 4.
+func TestCMAC(t *testing.T) {
+	key, err := ParseKey("2b7e151628aed2a6abf7158809cf4f3c")
+	assert.NoErrorT(t, err)
+
+	msg := unhex(t, "6bc1bee22e409f96e93d7e117393172a"+
+		"ae2d8a571e03ac9c9eb76fac45af8e51"+
+		"30c81c46a35ce411e5fbc1191a0a52ef"+
+		"f69f2445df4f9b17ad2b417be66c3710")
+
+	vectors := []struct {
+		n   int
+		mac string
+	}{
+		{0, "bb1d6929e95937287fa37d129b756746"},
+		{16, "070a16b46b4d4144f79bdd9dd04a287c"},
+		{40, "dfa66747de9ae63030ca32611497c827"},
+		{64, "51f0bebf7e3b9d92fc49741779363cfe"},
+	}
+
+	for _, v := range vectors {
+		mac := aesCMAC(key, msg[:v.n])
+		assert.BoolT(t, hex.EncodeToString(mac[:]) == v.mac, "CMAC mismatch")
+	}
+}
+
+func testSession(t *testing.T) *Session {
+	s := &Session{DeviceID: "backyard"}
+	var err error
+
+	s.DevAddr, err = ParseDevAddr("49BE7DF1")
+	assert.NoErrorT(t, err)
+	s.NwkSKey, err = ParseKey("44024241ed4ce9a68c6a8bc055233fd3")
+	assert.NoErrorT(t, err)
+	s.AppSKey, err = ParseKey("ec925802ae430ca77fd3dd73cb2cc588")
+	assert.NoErrorT(t, err)
+	return s
+}
+
+func TestDecodeUplink(t *testing.T) {
+	ks := NewMemoryKeyStore()
+	ks.Add(testSession(t))
+
+	phy := unhex(t, "40F17DBE4900020001954378762B11FF0D")
+	up, err := DecodeUplink(ks, phy)
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, up.Session.DeviceID == "backyard", "device ID")
+	assert.BoolT(t, up.Frame.MHDR.MType() == UnconfirmedDataUp, "message type")
+	assert.BoolT(t, up.FCnt == 2, "frame counter")
+	assert.BoolT(t, up.Port == 1, "port")
+	assert.BoolT(t, bytes.Equal(up.Payload, []byte("test")), "payload")
+
+	assert.BoolT(t, !up.Repeat, "first reception")
+
+	// The same frame from another gateway is a repeat.
+	up, err = DecodeUplink(ks, phy)
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, up.Repeat, "repeat")
+	assert.BoolT(t, bytes.Equal(up.Payload, []byte("test")), "repeated payload")
+
+	// Once a later frame has been received, it's a replay.
+	s, err := ks.Session(up.Session.DevAddr)
+	assert.NoErrorT(t, err)
+	s.FCntUp = 4
+	_, err = DecodeUplink(ks, phy)
+	assert.ErrorEqT(t, ErrFCnt, err)
+}
+
+func TestDecodeUplinkBadMIC(t *testing.T) {
+	ks := NewMemoryKeyStore()
+	ks.Add(testSession(t))
+
+	phy := unhex(t, "40F17DBE4900020001954378762B11FF0E")
+	_, err := DecodeUplink(ks, phy)
+	assert.ErrorEqT(t, ErrMIC, err)
+
+	phy = unhex(t, "40F17DBE4A00020001954378762B11FF0D")
+	_, err = DecodeUplink(ks, phy)
+	assert.ErrorEqT(t, ErrUnknownDevice, err)
+}
+
+func TestFullFCnt(t *testing.T) {
+	s := &Session{FCntUp: 0x1fffe}
+	assert.BoolT(t, s.fullFCnt(0xffff) == 0x1ffff, "same epoch")
+	assert.BoolT(t, s.fullFCnt(0x0001) == 0x20001, "rollover")
+}
+
+func TestParseFirmwareKey(t *testing.T) {
+	key, err := ParseKey("8B-5B-3-4C-A2-0-1E-F1-D2-9-BB-7F-3E-1-40-6D")
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, hex.EncodeToString(key[:]) == "8b5b034ca2001ef1d209bb7f3e01406d", "firmware key")
+
+	_, err = ParseKey("8B-5B-3")
+	assert.ErrorT(t, err)
+
+	addr, err := ParseDevAddr("260214E")
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, addr.String() == "0260214E", "short device address")
+}
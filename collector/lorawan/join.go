@@ -0,0 +1,284 @@
+package lorawan
+
+import (
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// JoinAcceptDelay1 is the delay, in microseconds, between the end of
+// a join request and the device's first receive window.
+const JoinAcceptDelay1 = 5000000
+
+var (
+	ErrNotJoinRequest = errors.New("lorawan: not a join request")
+	ErrUnknownEUI     = errors.New("lorawan: unknown device EUI")
+	ErrAppEUI         = errors.New("lorawan: join request has the wrong AppEUI")
+	ErrDevNonce       = errors.New("lorawan: DevNonce has already been used")
+)
+
+// EUI64 is an IEEE EUI-64, held in the display order used by the
+// consoles. On the air they are little-endian; the firmware's APPEUI
+// and DEVEUI arrays are too.
+type EUI64 [8]byte
+
+func (eui EUI64) String() string {
+	return strings.ToUpper(hex.EncodeToString(eui[:]))
+}
+
+func ParseEUI64(s string) (EUI64, error) {
+	var eui EUI64
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != len(eui) {
+		return eui, fmt.Errorf("lorawan: invalid EUI %q", s)
+	}
+	copy(eui[:], b)
+	return eui, nil
+}
+
+func reverse(dst, src []byte) {
+	for i := range src {
+		dst[len(src)-1-i] = src[i]
+	}
+}
+
+// JoinRequestFrame is an OTAA join request.
+type JoinRequestFrame struct {
+	AppEUI   EUI64
+	DevEUI   EUI64
+	DevNonce uint16
+	MIC      [4]byte
+
+	raw []byte
+}
+
+// ParseJoinRequest parses a join request PHYPayload.
+func ParseJoinRequest(phy []byte) (*JoinRequestFrame, error) {
+	if len(phy) < 1 || MHDR(phy[0]).MType() != JoinRequest {
+		return nil, ErrNotJoinRequest
+	}
+
+	if len(phy) != 23 {
+		return nil, ErrShortFrame
+	}
+
+	if MHDR(phy[0]).Major() != MajorLoRaWANR1 {
+		return nil, ErrMajorVersion
+	}
+
+	jr := &JoinRequestFrame{raw: phy[:19]}
+	reverse(jr.AppEUI[:], phy[1:9])
+	reverse(jr.DevEUI[:], phy[9:17])
+	jr.DevNonce = binary.LittleEndian.Uint16(phy[17:19])
+	copy(jr.MIC[:], phy[19:])
+	return jr, nil
+}
+
+// VerifyMIC checks the join request against the device's AppKey.
+func (jr *JoinRequestFrame) VerifyMIC(appKey [16]byte) bool {
+	mic := aesCMAC(appKey, jr.raw)
+	return subtle.ConstantTimeCompare(mic[:4], jr.MIC[:]) == 1
+}
+
+// DeriveSessionKeys computes the NwkSKey and AppSKey for a join.
+func DeriveSessionKeys(appKey [16]byte, appNonce, netID uint32, devNonce uint16) (nwkSKey, appSKey [16]byte) {
+	block, err := aes.NewCipher(appKey[:])
+	if err != nil {
+		panic(err)
+	}
+
+	var b [16]byte
+	b[1] = byte(appNonce)
+	b[2] = byte(appNonce >> 8)
+	b[3] = byte(appNonce >> 16)
+	b[4] = byte(netID)
+	b[5] = byte(netID >> 8)
+	b[6] = byte(netID >> 16)
+	binary.LittleEndian.PutUint16(b[7:], devNonce)
+
+	b[0] = 0x01
+	block.Encrypt(nwkSKey[:], b[:])
+	b[0] = 0x02
+	block.Encrypt(appSKey[:], b[:])
+	return nwkSKey, appSKey
+}
+
+// JoinAcceptFrame holds the fields of a join accept.
+type JoinAcceptFrame struct {
+	AppNonce   uint32
+	NetID      uint32
+	DevAddr    DevAddr
+	DLSettings uint8
+	RxDelay    uint8
+	CFList     []byte
+}
+
+// Marshal builds the encrypted join accept PHYPayload.
+func (ja *JoinAcceptFrame) Marshal(appKey [16]byte) []byte {
+	msg := make([]byte, 13, 33)
+	msg[0] = byte(JoinAccept << 5)
+	msg[1] = byte(ja.AppNonce)
+	msg[2] = byte(ja.AppNonce >> 8)
+	msg[3] = byte(ja.AppNonce >> 16)
+	msg[4] = byte(ja.NetID)
+	msg[5] = byte(ja.NetID >> 8)
+	msg[6] = byte(ja.NetID >> 16)
+	binary.LittleEndian.PutUint32(msg[7:], ja.DevAddr.uint32())
+	msg[11] = ja.DLSettings
+	msg[12] = ja.RxDelay
+	msg = append(msg, ja.CFList...)
+
+	mic := aesCMAC(appKey, msg)
+	msg = append(msg, mic[:4]...)
+
+	// The network server "decrypts" the join accept so that the
+	// device only needs to implement AES encryption.
+	block, err := aes.NewCipher(appKey[:])
+	if err != nil {
+		panic(err)
+	}
+
+	for i := 1; i < len(msg); i += aes.BlockSize {
+		block.Decrypt(msg[i:i+aes.BlockSize], msg[i:i+aes.BlockSize])
+	}
+	return msg
+}
+
+// Device is an OTAA device's root keys.
+type Device struct {
+	DeviceID string
+	AppID    string
+	DevEUI   EUI64
+	AppEUI   EUI64
+	AppKey   [16]byte
+}
+
+// DeviceStore looks up OTAA devices.
+type DeviceStore interface {
+	// Device returns the device, or ErrUnknownEUI.
+	Device(devEUI EUI64) (*Device, error)
+}
+
+// JoinStore persists the state the join server creates.
+type JoinStore interface {
+	KeyStore
+
+	// UseDevNonce records a DevNonce for a device; it returns
+	// ErrDevNonce if the device has used it before.
+	UseDevNonce(devEUI EUI64, nonce uint16) error
+
+	// SaveSession stores a new session, replacing the device's
+	// previous one.
+	SaveSession(s *Session) error
+}
+
+// JoinServer answers OTAA join requests.
+type JoinServer struct {
+	// NetID is the network's identifier. The default of 0 is one
+	// of the IDs reserved for private networks.
+	NetID uint32
+
+	// RxDelay is the RX1 delay, in seconds, given to joined
+	// devices; 0 is treated as 1 by devices.
+	RxDelay uint8
+
+	Devices DeviceStore
+	Store   JoinStore
+}
+
+func randomUint32() (uint32, error) {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b[:]), nil
+}
+
+// newDevAddr picks a free address. The top seven bits hold the NwkID,
+// the low seven bits of the NetID.
+func (js *JoinServer) newDevAddr() (DevAddr, error) {
+	var addr DevAddr
+	for {
+		n, err := randomUint32()
+		if err != nil {
+			return addr, err
+		}
+
+		n = (js.NetID&0x7f)<<25 | n&0x01ffffff
+		binary.BigEndian.PutUint32(addr[:], n)
+
+		_, err = js.Store.Session(addr)
+		if err == ErrUnknownDevice {
+			return addr, nil
+		} else if err != nil {
+			return addr, err
+		}
+	}
+}
+
+// Join validates a join request and creates a new session for the
+// device. It returns the session and the join accept PHYPayload to
+// send to the device. The session isn't stored until it's passed to
+// Activate, once the accept has been sent; until then, the device
+// keeps its old session.
+func (js *JoinServer) Join(phy []byte) (*Session, []byte, error) {
+	jr, err := ParseJoinRequest(phy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dev, err := js.Devices.Device(jr.DevEUI)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if dev.AppEUI != jr.AppEUI {
+		return nil, nil, ErrAppEUI
+	}
+
+	if !jr.VerifyMIC(dev.AppKey) {
+		return nil, nil, ErrMIC
+	}
+
+	err = js.Store.UseDevNonce(dev.DevEUI, jr.DevNonce)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	appNonce, err := randomUint32()
+	if err != nil {
+		return nil, nil, err
+	}
+	appNonce &= 0xffffff
+
+	s := &Session{
+		DeviceID: dev.DeviceID,
+		AppID:    dev.AppID,
+		DevEUI:   dev.DevEUI.String(),
+	}
+
+	s.DevAddr, err = js.newDevAddr()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.NwkSKey, s.AppSKey = DeriveSessionKeys(dev.AppKey, appNonce, js.NetID, jr.DevNonce)
+	ja := &JoinAcceptFrame{
+		AppNonce: appNonce,
+		NetID:    js.NetID,
+		DevAddr:  s.DevAddr,
+		RxDelay:  js.RxDelay,
+	}
+	return s, ja.Marshal(dev.AppKey), nil
+}
+
+// Activate stores a session created by Join, replacing the device's
+// old one, once its join accept has been sent.
+func (js *JoinServer) Activate(s *Session) error {
+	return js.Store.SaveSession(s)
+}
@@ -0,0 +1,121 @@
+package lorawan
+
+import (
+	"crypto/aes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/kisom/goutils/assert"
+)
+
+func testDevice(t *testing.T) *Device {
+	d := &Device{DeviceID: "backyard", AppID: "fls"}
+	var err error
+
+	d.DevEUI, err = ParseEUI64("009CB1747141CD05")
+	assert.NoErrorT(t, err)
+	d.AppEUI, err = ParseEUI64("70B3D57ED0023F4B")
+	assert.NoErrorT(t, err)
+	d.AppKey, err = ParseKey("2B7E151628AED2A6ABF7158809CF4F3C")
+	assert.NoErrorT(t, err)
+	return d
+}
+
+// joinRequest builds a join request the way LMIC does.
+func joinRequest(d *Device, devNonce uint16) []byte {
+	phy := make([]byte, 19, 23)
+	phy[0] = byte(JoinRequest << 5)
+	reverse(phy[1:9], d.AppEUI[:])
+	reverse(phy[9:17], d.DevEUI[:])
+	binary.LittleEndian.PutUint16(phy[17:], devNonce)
+
+	mic := aesCMAC(d.AppKey, phy)
+	return append(phy, mic[:4]...)
+}
+
+func TestJoin(t *testing.T) {
+	d := testDevice(t)
+	ks := NewMemoryKeyStore()
+	ks.AddDevice(d)
+
+	js := &JoinServer{NetID: 0x13, RxDelay: 1, Devices: ks, Store: ks}
+	s, accept, err := js.Join(joinRequest(d, 0x1234))
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, s.DeviceID == "backyard", "device ID")
+	assert.BoolT(t, s.DevAddr[0]>>1 == 0x13, "NwkID")
+	assert.BoolT(t, len(accept) == 17, "join accept length")
+	assert.BoolT(t, MHDR(accept[0]).MType() == JoinAccept, "join accept MHDR")
+
+	// Decrypt the accept as the device would.
+	block, err := aes.NewCipher(d.AppKey[:])
+	assert.NoErrorT(t, err)
+	block.Encrypt(accept[1:], accept[1:])
+
+	mic := aesCMAC(d.AppKey, accept[:13])
+	assert.BoolT(t, string(mic[:4]) == string(accept[13:]), "join accept MIC")
+
+	var addr DevAddr
+	binary.BigEndian.PutUint32(addr[:], binary.LittleEndian.Uint32(accept[7:]))
+	assert.BoolT(t, addr == s.DevAddr, "device address")
+	assert.BoolT(t, accept[12] == 1, "RX delay")
+
+	appNonce := uint32(accept[1]) | uint32(accept[2])<<8 | uint32(accept[3])<<16
+	netID := uint32(accept[4]) | uint32(accept[5])<<8 | uint32(accept[6])<<16
+	assert.BoolT(t, netID == 0x13, "NetID")
+
+	nwkSKey, appSKey := DeriveSessionKeys(d.AppKey, appNonce, netID, 0x1234)
+	assert.BoolT(t, nwkSKey == s.NwkSKey, "NwkSKey")
+	assert.BoolT(t, appSKey == s.AppSKey, "AppSKey")
+
+	// The session is only stored once the accept has been sent.
+	_, err = ks.Session(s.DevAddr)
+	assert.ErrorEqT(t, ErrUnknownDevice, err)
+	assert.NoErrorT(t, js.Activate(s))
+
+	stored, err := ks.Session(s.DevAddr)
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, stored == s, "session should be stored")
+
+	_, _, err = js.Join(joinRequest(d, 0x1234))
+	assert.ErrorEqT(t, ErrDevNonce, err)
+}
+
+func TestJoinRejected(t *testing.T) {
+	d := testDevice(t)
+	ks := NewMemoryKeyStore()
+	ks.AddDevice(d)
+	js := &JoinServer{Devices: ks, Store: ks}
+
+	phy := joinRequest(d, 1)
+	phy[len(phy)-1] ^= 0xff
+	_, _, err := js.Join(phy)
+	assert.ErrorEqT(t, ErrMIC, err)
+
+	other := testDevice(t)
+	other.DevEUI[7]++
+	_, _, err = js.Join(joinRequest(other, 1))
+	assert.ErrorEqT(t, ErrUnknownEUI, err)
+}
+
+func TestUS915RX1(t *testing.T) {
+	vectors := []struct {
+		freq  float64
+		datr  string
+		down  float64
+		ddatr string
+	}{
+		{903.9, "SF10BW125", 923.3, "SF10BW500"},
+		{905.3, "SF7BW125", 927.5, "SF7BW500"},
+		{904.6, "SF8BW500", 923.9, "SF7BW500"},
+	}
+
+	for _, v := range vectors {
+		freq, datr, err := US915RX1(v.freq, v.datr)
+		assert.NoErrorT(t, err)
+		assert.BoolT(t, freq == v.down, "RX1 frequency")
+		assert.BoolT(t, datr == v.ddatr, "RX1 data rate")
+	}
+
+	_, _, err := US915RX1(868.1, "SF7BW125")
+	assert.ErrorT(t, err)
+}
@@ -0,0 +1,58 @@
+package lorawan
+
+import (
+	"fmt"
+	"math"
+)
+
+// The nodes are built with CFG_us915, so only the US902-928 channel
+// plan is implemented.
+const (
+	us915Uplink125Base  = 902.3
+	us915Uplink125Step  = 0.2
+	us915Uplink500Base  = 903.0
+	us915Uplink500Step  = 1.6
+	us915DownlinkBase   = 923.3
+	us915DownlinkStep   = 0.6
+	us915UplinkChannels = 64
+)
+
+// US915RX1 returns the frequency and data rate of the first receive
+// window for an uplink, with an RX1DROffset of 0.
+func US915RX1(freq float64, datr string) (float64, string, error) {
+	var ch int
+	var sf, bw int
+
+	_, err := fmt.Sscanf(datr, "SF%dBW%d", &sf, &bw)
+	if err != nil {
+		return 0, "", fmt.Errorf("lorawan: invalid data rate %s", datr)
+	}
+
+	switch bw {
+	case 125:
+		ch = int(math.Round((freq - us915Uplink125Base) / us915Uplink125Step))
+		if sf < 7 || sf > 10 {
+			return 0, "", fmt.Errorf("lorawan: invalid US915 data rate %s", datr)
+		}
+	case 500:
+		ch = us915UplinkChannels + int(math.Round((freq-us915Uplink500Base)/us915Uplink500Step))
+		if sf != 8 {
+			return 0, "", fmt.Errorf("lorawan: invalid US915 data rate %s", datr)
+		}
+		// DR4 maps to DR13.
+		sf = 7
+	default:
+		return 0, "", fmt.Errorf("lorawan: invalid US915 data rate %s", datr)
+	}
+
+	if ch < 0 || ch >= us915UplinkChannels+8 {
+		return 0, "", fmt.Errorf("lorawan: %0.1f MHz is not a US915 uplink channel", freq)
+	}
+
+	down := us915DownlinkBase + float64(ch%8)*us915DownlinkStep
+	return math.Round(down*10) / 10, fmt.Sprintf("SF%dBW500", sf), nil
+}
+
+// US915DownlinkPower is the transmit power, in dBm, used for
+// downlinks.
+const US915DownlinkPower = 20
@@ -0,0 +1,394 @@
+package lorawan
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gokyle/goconfig"
+)
+
+// MaxFCntGap is the largest jump in the frame counter that will be
+// accepted from a device.
+const MaxFCntGap = 16384
+
+var (
+	ErrUnknownDevice = errors.New("lorawan: no session for device address")
+	ErrFCnt          = errors.New("lorawan: frame counter replayed or out of range")
+)
+
+// Session holds the keys a device negotiated when it activated.
+type Session struct {
+	DeviceID string
+	AppID    string
+	DevEUI   string
+	DevAddr  DevAddr
+	NwkSKey  [16]byte
+	AppSKey  [16]byte
+
+	// FCntUp is the next uplink frame counter expected from the
+	// device.
+	FCntUp uint32
+}
+
+// fullFCnt reconstructs the 32-bit frame counter from the 16 bits
+// sent over the air.
+func (s *Session) fullFCnt(fcnt uint16) uint32 {
+	full := s.FCntUp&0xffff0000 | uint32(fcnt)
+	if full < s.FCntUp {
+		full += 0x10000
+	}
+	return full
+}
+
+// Uplink is a verified and decrypted data uplink.
+type Uplink struct {
+	Session *Session
+	Frame   *DataFrame
+	FCnt    uint32
+
+	// Port is the FPort of the frame, or -1 if there was no
+	// payload.
+	Port    int
+	Payload []byte
+
+	// Repeat is set if the frame was the last one received from
+	// the device, heard again by another gateway.
+	Repeat bool
+}
+
+// Decode verifies the frame's MIC and decrypts its payload. The
+// session's frame counter is advanced on success. The last frame
+// received is decoded again, as Repeat, since every gateway in range
+// forwards it.
+func (s *Session) Decode(f *DataFrame) (*Uplink, error) {
+	fcnt := s.fullFCnt(f.FCnt)
+	repeat := s.FCntUp > 0 && f.FCnt == uint16(s.FCntUp-1)
+	if repeat {
+		fcnt = s.FCntUp - 1
+	} else if fcnt-s.FCntUp >= MaxFCntGap {
+		return nil, ErrFCnt
+	}
+
+	if !f.VerifyMIC(s.NwkSKey, fcnt) {
+		return nil, ErrMIC
+	}
+
+	if !repeat {
+		s.FCntUp = fcnt + 1
+	}
+
+	up := &Uplink{
+		Session: s,
+		Frame:   f,
+		FCnt:    fcnt,
+		Port:    -1,
+		Repeat:  repeat,
+	}
+
+	if f.FPort == nil {
+		return up, nil
+	}
+
+	up.Port = int(*f.FPort)
+	key := s.AppSKey
+	if up.Port == 0 {
+		// FPort 0 carries MAC commands, encrypted with the network key.
+		key = s.NwkSKey
+	}
+	up.Payload = cryptPayload(key, f.dir(), f.DevAddr, fcnt, f.FRMPayload)
+	return up, nil
+}
+
+// KeyStore looks up device sessions.
+type KeyStore interface {
+	// Session returns the session for a device address, or
+	// ErrUnknownDevice.
+	Session(addr DevAddr) (*Session, error)
+
+	// UpdateSession records a session's new frame counter.
+	UpdateSession(s *Session) error
+}
+
+// DecodeUplink parses a data uplink and decodes it with the session
+// from the key store.
+func DecodeUplink(ks KeyStore, phy []byte) (*Uplink, error) {
+	f, err := ParseDataFrame(phy)
+	if err != nil {
+		return nil, err
+	}
+
+	if !f.MHDR.MType().Uplink() {
+		return nil, ErrNotDataFrame
+	}
+
+	s, err := ks.Session(f.DevAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	up, err := s.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return up, ks.UpdateSession(s)
+}
+
+// MemoryKeyStore keeps devices and sessions in memory.
+type MemoryKeyStore struct {
+	lock      sync.Mutex
+	sessions  map[DevAddr]*Session
+	devices   map[EUI64]*Device
+	devNonces map[EUI64]map[uint16]bool
+}
+
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{
+		sessions:  map[DevAddr]*Session{},
+		devices:   map[EUI64]*Device{},
+		devNonces: map[EUI64]map[uint16]bool{},
+	}
+}
+
+// Add stores a session, replacing any other session using the same
+// address.
+func (ks *MemoryKeyStore) Add(s *Session) {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+	ks.sessions[s.DevAddr] = s
+}
+
+// AddDevice registers an OTAA device.
+func (ks *MemoryKeyStore) AddDevice(d *Device) {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+	ks.devices[d.DevEUI] = d
+}
+
+func (ks *MemoryKeyStore) Session(addr DevAddr) (*Session, error) {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	s, ok := ks.sessions[addr]
+	if !ok {
+		return nil, ErrUnknownDevice
+	}
+	return s, nil
+}
+
+func (ks *MemoryKeyStore) UpdateSession(s *Session) error {
+	return nil
+}
+
+func (ks *MemoryKeyStore) Device(devEUI EUI64) (*Device, error) {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	d, ok := ks.devices[devEUI]
+	if !ok {
+		return nil, ErrUnknownEUI
+	}
+	return d, nil
+}
+
+func (ks *MemoryKeyStore) UseDevNonce(devEUI EUI64, nonce uint16) error {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	if ks.devNonces[devEUI] == nil {
+		ks.devNonces[devEUI] = map[uint16]bool{}
+	}
+
+	if ks.devNonces[devEUI][nonce] {
+		return ErrDevNonce
+	}
+	ks.devNonces[devEUI][nonce] = true
+	return nil
+}
+
+func (ks *MemoryKeyStore) SaveSession(s *Session) error {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	for addr, old := range ks.sessions {
+		if old.DeviceID == s.DeviceID {
+			delete(ks.sessions, addr)
+		}
+	}
+	ks.sessions[s.DevAddr] = s
+	return nil
+}
+
+// ParseKey parses a 128-bit key, either as 32 hex digits or as it is
+// printed by the firmware on EV_JOINED: dash-separated bytes with the
+// leading zeros dropped, e.g. "1A-2B-3-...".
+func ParseKey(s string) ([16]byte, error) {
+	var key [16]byte
+
+	if !strings.Contains(s, "-") {
+		b, err := hex.DecodeString(s)
+		if err != nil || len(b) != len(key) {
+			return key, fmt.Errorf("lorawan: invalid key %q", s)
+		}
+		copy(key[:], b)
+		return key, nil
+	}
+
+	parts := strings.Split(s, "-")
+	if len(parts) != len(key) {
+		return key, fmt.Errorf("lorawan: invalid key %q", s)
+	}
+
+	for i, part := range parts {
+		b, err := strconv.ParseUint(part, 16, 8)
+		if err != nil {
+			return key, fmt.Errorf("lorawan: invalid key %q", s)
+		}
+		key[i] = byte(b)
+	}
+
+	return key, nil
+}
+
+// SessionFromMap builds an ABP-style session from a config section.
+// The devaddr, artKey and nwkKey values can be copied straight from
+// the firmware's EV_JOINED output.
+func SessionFromMap(name string, cfg map[string]string) (*Session, error) {
+	var err error
+	s := &Session{
+		DeviceID: name,
+		AppID:    cfg["app_id"],
+		DevEUI:   strings.ToUpper(cfg["dev_eui"]),
+	}
+
+	missing := func(v string) error {
+		return fmt.Errorf("lorawan: session for %s is missing %s", name, v)
+	}
+
+	if cfg["devaddr"] == "" {
+		return nil, missing("devaddr")
+	}
+	s.DevAddr, err = ParseDevAddr(cfg["devaddr"])
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg["nwkKey"] == "" {
+		return nil, missing("nwkKey")
+	}
+	s.NwkSKey, err = ParseKey(cfg["nwkKey"])
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg["artKey"] == "" {
+		return nil, missing("artKey")
+	}
+	s.AppSKey, err = ParseKey(cfg["artKey"])
+	if err != nil {
+		return nil, err
+	}
+
+	if fcnt, ok := cfg["fcnt_up"]; ok {
+		n, err := strconv.ParseUint(fcnt, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		s.FCntUp = uint32(n)
+	}
+
+	return s, nil
+}
+
+// DeviceFromMap builds an OTAA device from a config section. The
+// EUIs are given in the order the TTN console displays them, which is
+// the reverse of the firmware's APPEUI and DEVEUI arrays.
+func DeviceFromMap(name string, cfg map[string]string) (*Device, error) {
+	var err error
+	d := &Device{
+		DeviceID: name,
+		AppID:    cfg["app_id"],
+	}
+
+	missing := func(v string) error {
+		return fmt.Errorf("lorawan: device %s is missing %s", name, v)
+	}
+
+	if cfg["dev_eui"] == "" {
+		return nil, missing("dev_eui")
+	}
+	d.DevEUI, err = ParseEUI64(cfg["dev_eui"])
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg["app_eui"] == "" {
+		return nil, missing("app_eui")
+	}
+	d.AppEUI, err = ParseEUI64(cfg["app_eui"])
+	if err != nil {
+		return nil, err
+	}
+
+	d.AppKey, err = ParseKey(cfg["app_key"])
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// LoadSessions reads a device file with one section per device, named
+// after the device ID. A device with an app_key can join over OTAA;
+// one with session keys is given an ABP-style session, e.g.
+//
+//	[backyard]
+//	app_id = fls
+//	dev_eui = 009CB1747141CD05
+//	app_eui = 70B3D57ED0023F4B
+//	app_key = 2B7E151628AED2A6ABF7158809CF4F3C
+//	devaddr = 260214E3
+//	artKey = 8B-5B-...
+//	nwkKey = 3C-F-...
+func LoadSessions(path string) (*MemoryKeyStore, error) {
+	cfg, err := goconfig.ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ks := NewMemoryKeyStore()
+	for _, name := range cfg.ListSections() {
+		if name == goconfig.DefaultSection {
+			continue
+		}
+
+		section := cfg[name]
+		_, otaa := section["app_key"]
+		_, abp := section["devaddr"]
+		if !otaa && !abp {
+			return nil, fmt.Errorf("lorawan: device %s has no keys", name)
+		}
+
+		if otaa {
+			d, err := DeviceFromMap(name, section)
+			if err != nil {
+				return nil, err
+			}
+			ks.AddDevice(d)
+		}
+
+		if abp {
+			s, err := SessionFromMap(name, section)
+			if err != nil {
+				return nil, err
+			}
+			ks.Add(s)
+		}
+	}
+
+	return ks, nil
+}
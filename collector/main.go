@@ -1,101 +1,311 @@
 package main
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"sort"
+	"sync"
 	"time"
 
+	"github.com/kisom/redenv/collector/chirpstack"
+	"github.com/kisom/redenv/collector/lorawan"
+	"github.com/kisom/redenv/collector/reading"
+	"github.com/kisom/redenv/collector/semtech"
+	"github.com/kisom/redenv/collector/spool"
+	"github.com/kisom/redenv/collector/storage"
 	"github.com/kisom/redenv/collector/ttn"
-	_ "github.com/lib/pq"
 )
 
 var (
 	config *Config
-	db     *sql.DB
+	store  storage.Store
 )
 
 const timeFormat = "2006-01-02 15:04:05 MST"
 
 func httpError(w http.ResponseWriter, err error, code int) {
 	log.Printf("[ERROR] %s", err)
-	http.Error(w, err.Error(), http.StatusInternalServerError)
+	http.Error(w, err.Error(), code)
 	return
 }
 
-func redenvCollector(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-	}
+// anchors holds the last trustworthy time from each device, which is
+// used to place readings sent after its clock was reset.
+var anchors = struct {
+	sync.Mutex
+	byDevice map[string]*reading.TimeAnchor
+}{byDevice: map[string]*reading.TimeAnchor{}}
 
-	uplink := &ttn.Uplink{}
-	err = json.Unmarshal(body, uplink)
-	if err != nil {
-		httpError(w, err, http.StatusInternalServerError)
+// recoverTime corrects the reading's time if the node's clock is bad,
+// or remembers it as the device's anchor if it's good.
+func recoverTime(r *reading.Reading) {
+	anchors.Lock()
+	defer anchors.Unlock()
+
+	if r.RecoverTime(anchors.byDevice[r.Device]) {
+		log.Printf("reading from %s had time %s; corrected to %s", r.Device,
+			r.OriginalWhen.Format(timeFormat), r.When.Format(timeFormat))
 		return
 	}
 
+	if anchor := r.Anchor(); anchor != nil {
+		anchors.byDevice[r.Device] = anchor
+	}
+}
+
+// ingest decodes and stores an uplink. If its payload can't be
+// decoded, it is stored without a reading and errUndecoded is
+// returned. If the database is unavailable, the uplink is spooled to
+// be stored later and errSpooled is returned; uplinks that arrive
+// while others are spooled join the end of the spool, so that they're
+// stored in order. Errors that storing again wouldn't fix are
+// returned as they are.
+func ingest(msg ttn.Message) error {
+	uplink := msg.Uplink()
+
 	log.Printf("received uplink from %s (%s) @ %s: %s",
 		uplink.DevID,
 		uplink.HardwareSerial,
 		uplink.Metadata.Time,
 		uplink.PayloadRaw)
 
+	if uplinkSpool != nil && uplinkSpool.Depth() > 0 {
+		return spoolUplink(uplink)
+	}
+
+	err := storeUplink(uplink)
+	if uplinkSpool == nil || !storage.Unavailable(err) {
+		return err
+	}
+
+	log.Printf("[ERROR] storing uplink from %s: %s", uplink.DevID, err)
+	return spoolUplink(uplink)
+}
+
+// storeUplink decodes an uplink and stores it with its reading. An
+// uplink whose payload can't be decoded is kept without one, so that
+// it can be reprocessed once the decoder is fixed.
+func storeUplink(uplink *ttn.Uplink) error {
 	reading, err := uplink.ToReading()
+	if err != nil {
+		return storeUndecoded(uplink, err)
+	}
+	return storeReading(reading, uplink)
+}
+
+// storeUndecoded stores an uplink whose payload couldn't be decoded,
+// returning errUndecoded.
+func storeUndecoded(uplink *ttn.Uplink, decodeErr error) error {
+	log.Printf("[ERROR] decoding uplink %d from %s: %s", uplink.Counter, uplink.DevID, decodeErr)
+
+	receivedAt, err := time.Parse(time.RFC3339, uplink.Metadata.Time)
+	if err != nil {
+		receivedAt = time.Now()
+	}
+
+	_, err = store.InsertUplink(uplink, receivedAt)
+	if err != nil && err != storage.ErrDuplicate {
+		return err
+	}
+	return errUndecoded
+}
+
+// storeReading fills in what the collector knows about the reading's
+// device and stores it with its uplink.
+func storeReading(reading *reading.Reading, uplink *ttn.Uplink) error {
+	config.Device(reading.Device).Apply(reading)
+	recoverTime(reading)
+
+	if err := prepareReading(reading, store.SensorFirstSeen); err != nil {
+		return err
+	}
+
+	err := store.StoreUplink(reading, uplink)
+	if err == storage.ErrDuplicate {
+		log.Printf("uplink %d from %s was already stored", uplink.Counter, uplink.DevID)
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	log.Printf("reading from %s @ %s stored", uplink.DevID,
+		reading.When.In(reading.Location()).Format(timeFormat))
+	return nil
+}
+
+// A sensorLookup returns when a device's sensor was first seen,
+// taking it as first seen at when if it's new.
+type sensorLookup func(device, sensor string, when time.Time) (time.Time, error)
+
+// prepareReading calibrates a reading whose time has been settled,
+// and checks its CCS811 conditioning and its validity.
+func prepareReading(reading *reading.Reading, firstSeen sensorLookup) error {
+	cals, err := store.Calibrations(reading.Device)
+	if err != nil {
+		return err
+	}
+	reading.Calibrate(cals)
+
+	if reading.HasCCS811() {
+		firstSeen, err := firstSeen(reading.Device, "ccs811", reading.When)
+		if err != nil {
+			return err
+		}
+		reading.CheckConditioning(firstSeen)
+	}
+
+	// Implausible fields are flagged and stored anyway.
+	if err = reading.Validate(); err != nil {
+		log.Printf("[WARNING] reading from %s: %s", reading.Device, err)
+	}
+	return nil
+}
+
+// errUndecoded is returned by ingest when an uplink was stored without
+// a reading because its payload couldn't be decoded.
+var errUndecoded = errors.New("collector: uplink stored without a reading")
+
+// storeMessage ingests an uplink delivered over HTTP. Duplicates and
+// spooled uplinks are acknowledged, so that the network server stops
+// retrying them.
+func storeMessage(w http.ResponseWriter, msg ttn.Message) {
+	err := ingest(msg)
+	switch err {
+	case nil:
+		fmt.Fprintln(w, "stored")
+	case storage.ErrDuplicate:
+		fmt.Fprintln(w, "already stored")
+	case errUndecoded:
+		fmt.Fprintln(w, "stored without a reading; the payload couldn't be decoded")
+	case errSpooled:
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintln(w, "spooled")
+	default:
+		httpError(w, err, http.StatusInternalServerError)
+	}
+}
+
+func redenvCollector(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		httpError(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	err = StoreUplink(db, reading, uplink)
+	// The Things Stack sends join, ack and location events to the
+	// same webhook; they're acknowledged so that it stops retrying.
+	msg, err := ttn.Parse(body)
+	if err == ttn.ErrNotUplink {
+		log.Printf("ignoring v3 message that isn't an uplink")
+		fmt.Fprintln(w, "ignored")
+		return
+	} else if err != nil {
+		httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	storeMessage(w, msg)
+}
+
+// chirpstackCollector receives events from the ChirpStack HTTP
+// integration. Only uplinks are stored; the other events are
+// acknowledged and dropped.
+func chirpstackCollector(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		httpError(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("reading from %s @ %s stored", uplink.DevID,
-		reading.When.Format(timeFormat))
+	event := r.URL.Query().Get("event")
+	if event != chirpstack.EventUplink {
+		log.Printf("ignoring chirpstack %s event", event)
+		return
+	}
+
+	uplink := &chirpstack.Uplink{}
+	err = json.Unmarshal(body, uplink)
+	if err != nil {
+		httpError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	storeMessage(w, uplink)
 }
 
 func index(w http.ResponseWriter, req *http.Request) {
-	u := &ttn.Uplink{}
-	var timestamp int64
-
-	row := db.QueryRow(`SELECT
-	app_id, dev_id, hw_serial, port, counter,
-	is_retry, is_confirmed, payload_raw, uplink_time,
-	frequency, modulation, data_rate, bit_rate
-FROM uplinks
-ORDER BY uplink_time DESC
-LIMIT 1`)
-	err := row.Scan(
-		&u.AppID, &u.DevID, &u.HardwareSerial, &u.Port,
-		&u.Counter, &u.IsRetry, &u.Confirmed, &u.PayloadRaw,
-		&timestamp, &u.Metadata.Frequency, &u.Metadata.Modulation,
-		&u.Metadata.DataRate, &u.Metadata.BitRate,
-	)
+	page := `fls-collector/web v1.0.0
+Node location: 37.823°N 122.284°W (West Oakland, California, United States)
+
+`
+	if uplinkSpool != nil {
+		page += fmt.Sprintf("SPOOL\n%d uplinks waiting to be stored\n%d dead letters\n\n",
+			uplinkSpool.Depth(), uplinkSpool.Dead())
+	}
+
+	// The spool depth matters most when the store is down, so the
+	// page is still shown.
+	u, err := store.LatestUplink()
+	if err != nil {
+		log.Printf("[ERROR] %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "%sERROR\n%s\n", page, err)
+		return
+	}
+	page += fmt.Sprintf("LATEST UPLINK\n%s", u)
+
+	// The uplink shows what the node sent, or why it couldn't be
+	// decoded; the calibrations are applied as they stand now.
+	if r, err := u.ToReading(); err == nil {
+		config.Device(r.Device).Apply(r)
+
+		cals, err := store.Calibrations(r.Device)
+		if err != nil {
+			httpError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		r.Calibrate(cals)
+		if r.Raw != nil {
+			page += fmt.Sprintf("CALIBRATED READING\n%s", r)
+		}
+	}
+
+	duplicates, err := store.Duplicates()
 	if err != nil {
 		httpError(w, err, http.StatusInternalServerError)
 		return
 	}
-	u.Metadata.Time = time.Unix(timestamp, 0).Format(timeFormat)
-	page := fmt.Sprintf(`fls-collector/web v1.0.0
-Node location: 37.823°N 122.284°W (West Oakland, California, United States)
 
-LATEST UPLINK
-%s`, u)
+	if len(duplicates) > 0 {
+		var devices []string
+		for device := range duplicates {
+			devices = append(devices, device)
+		}
+		sort.Strings(devices)
+
+		page += "\nDUPLICATE UPLINKS\n"
+		for _, device := range devices {
+			page += fmt.Sprintf("%s: %d\n", device, duplicates[device])
+		}
+	}
 	w.Write([]byte(page))
 }
 
 func main() {
 	addr := "localhost:8006"
 	configFile := "collector.conf"
+	var forwarderAddr string
 	flag.StringVar(&addr, "a", addr, "`address` to listen on")
+	flag.StringVar(&forwarderAddr, "u", forwarderAddr,
+		"UDP `address` to listen on for Semtech packet forwarders (disabled if empty)")
 	flag.StringVar(&configFile, "f", configFile, "`path` to configuration file")
 	flag.Parse()
 
@@ -105,14 +315,86 @@ func main() {
 		log.Fatal(err)
 	}
 
-	db, err = sql.Open("postgres", config.Database.ConnStr())
+	if flag.Arg(0) == "migrate" {
+		if err = migrate(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	reading.Timezone = config.Timezone
+	log.Printf("showing readings in %s", config.Timezone)
+	for _, dev := range config.Devices {
+		if loc := dev.Timezone(); loc != nil {
+			reading.SetDeviceTimezone(dev.ID(), loc)
+		}
+	}
+
+	if path := config.Decoders.File(); path != "" {
+		err = reading.DefaultRegistry.LoadDecoders(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	store, err = openStore(config.Database)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.Close()
+	defer store.Close()
+
+	if flag.Arg(0) == "reprocess" {
+		if err = reprocess(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if dir := config.Spool.Dir(); dir != "" {
+		uplinkSpool, err = spool.Open(dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer uplinkSpool.Close()
+
+		log.Printf("spooling uplinks in %s (%d waiting)", dir, uplinkSpool.Depth())
+		go replaySpool()
+	}
+
+	if forwarderAddr != "" {
+		static := lorawan.NewMemoryKeyStore()
+		if path := config.LoRaWAN.Sessions(); path != "" {
+			static, err = lorawan.LoadSessions(path)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		sessions := &dbKeyStore{store: store, static: static}
+		keyStore = sessions
+		joinServer = &lorawan.JoinServer{
+			NetID:   config.LoRaWAN.NetID(),
+			RxDelay: 1,
+			Devices: static,
+			Store:   sessions,
+		}
+
+		forwarder, err = semtech.Listen(forwarderAddr, semtech.HandlerFunc(gatewayUplink))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer forwarder.Close()
+
+		log.Printf("listening for packet forwarders on %s", forwarder.Addr())
+		go gatewayWorker()
+		go func() {
+			log.Fatal(forwarder.Serve())
+		}()
+	}
 
 	http.HandleFunc("/", index)
-	http.HandleFunc("/fls/collector/uplink", redenvCollector)
+	http.HandleFunc("/fls/collector/uplink", authenticated(redenvCollector))
+	http.HandleFunc("/fls/collector/chirpstack", authenticated(chirpstackCollector))
 	log.Printf("listening on %s", addr)
 	log.Fatal(http.ListenAndServe(addr, nil))
 }
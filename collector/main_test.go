@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kisom/goutils/assert"
+	"github.com/kisom/redenv/collector/storage"
+	"github.com/kisom/redenv/collector/ttn"
+)
+
+func TestUndecodedUplink(t *testing.T) {
+	config = &Config{Devices: map[string]Device{}, Timezone: time.UTC}
+	store = storage.NewMemory()
+	defer func() { store = nil }()
+
+	u := &ttn.Uplink{
+		AppID:      "fls",
+		DevID:      "backyard",
+		Port:       1,
+		Counter:    7,
+		PayloadRaw: "AQID",
+		Metadata:   ttn.Metadata{Time: "2026-10-17T12:00:05Z"},
+	}
+	assert.ErrorEqT(t, ingest(u), errUndecoded)
+
+	uplinks, err := store.Uplinks("backyard", time.Unix(0, 0), time.Unix(1<<40, 0))
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, len(uplinks) == 1, "undecoded uplink stored")
+
+	// The index shows the uplink rather than failing on it.
+	w := httptest.NewRecorder()
+	index(w, httptest.NewRequest("GET", "/", nil))
+	assert.BoolT(t, w.Code == http.StatusOK, w.Body.String())
+	assert.BoolT(t, strings.Contains(w.Body.String(), "payload couldn't be decoded"),
+		w.Body.String())
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/kisom/redenv/collector/storage"
+)
+
+const migrateUsage = `usage: collector [-f config] migrate command [version]
+
+	up [version]	apply the pending migrations, up to version if given
+	down [version]	undo the last migration, or those after version
+	status		list the migrations and whether they're applied
+	mark version	record the migrations up to version as applied
+			without running them, for databases set up by
+			hand from the schema files`
+
+// migrate runs the migrate command against the configured database.
+func migrate(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New(migrateUsage)
+	}
+
+	var version int64
+	if len(args) == 2 {
+		var err error
+		version, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("collector: bad schema version %s", args[1])
+		}
+	}
+
+	s, err := openSQL(config.Database)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	var versions []int64
+	switch args[0] {
+	case "up":
+		versions, err = s.MigrateUp(version)
+		report("applied", versions)
+	case "down":
+		if len(args) == 1 {
+			version, err = previousVersion(s)
+			if err != nil {
+				return err
+			}
+		}
+		versions, err = s.MigrateDown(version)
+		report("undid", versions)
+	case "status":
+		return printStatus(s)
+	case "mark":
+		if len(args) != 2 {
+			return errors.New(migrateUsage)
+		}
+		versions, err = s.MarkApplied(version)
+		report("marked", versions)
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return err
+}
+
+// previousVersion returns the version before the last applied
+// migration, which down goes back to by default.
+func previousVersion(s *storage.SQLStore) (int64, error) {
+	status, err := s.Status()
+	if err != nil {
+		return 0, err
+	}
+
+	var applied []int64
+	for _, m := range status {
+		if m.Applied {
+			applied = append(applied, m.Version)
+		}
+	}
+
+	switch len(applied) {
+	case 0:
+		return 0, errors.New("collector: no migrations have been applied")
+	case 1:
+		return 0, nil
+	default:
+		return applied[len(applied)-2], nil
+	}
+}
+
+func report(what string, versions []int64) {
+	if len(versions) == 0 {
+		fmt.Println("nothing to do")
+		return
+	}
+
+	for _, v := range versions {
+		fmt.Printf("%s %d\n", what, v)
+	}
+}
+
+func printStatus(s *storage.SQLStore) error {
+	status, err := s.Status()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range status {
+		switch {
+		case m.Unknown:
+			fmt.Printf("%d\tunknown, applied %s\n", m.Version, m.AppliedAt.Format(timeFormat))
+		case m.Applied:
+			fmt.Printf("%d\tapplied %s\n", m.Version, m.AppliedAt.Format(timeFormat))
+		default:
+			fmt.Printf("%d\tpending\n", m.Version)
+		}
+	}
+
+	return nil
+}
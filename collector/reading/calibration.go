@@ -0,0 +1,174 @@
+package reading
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Quantities that can be calibrated.
+const (
+	QuantityTemperature = "temperature"
+	QuantityHumidity    = "humidity"
+	QuantityPressure    = "pressure"
+)
+
+// A CalibrationPoint maps a raw value to the corrected one.
+type CalibrationPoint struct {
+	Raw   float64
+	Value float64
+}
+
+// A Calibration corrects one quantity measured by a device. The raw
+// value is first looked up in Table, if there is one, interpolating
+// between points and extrapolating from the end segments; the result
+// is then multiplied by Gain and Offset is added.
+type Calibration struct {
+	Device   string
+	Quantity string
+	Offset   float64
+
+	// Gain of 0 is treated as 1.
+	Gain  float64
+	Table []CalibrationPoint
+
+	// The calibration applies to readings taken in [ValidFrom,
+	// ValidUntil); either may be zero to leave the range open.
+	ValidFrom  time.Time
+	ValidUntil time.Time
+}
+
+func (c Calibration) Validate() error {
+	switch c.Quantity {
+	case QuantityTemperature, QuantityHumidity, QuantityPressure:
+	default:
+		return fmt.Errorf("reading: can't calibrate %s", c.Quantity)
+	}
+
+	if len(c.Table) == 1 {
+		return fmt.Errorf("reading: %s calibration table needs at least two points",
+			c.Quantity)
+	}
+
+	for i := 1; i < len(c.Table); i++ {
+		if c.Table[i].Raw <= c.Table[i-1].Raw {
+			return fmt.Errorf("reading: %s calibration table must be sorted by raw value",
+				c.Quantity)
+		}
+	}
+
+	if !c.ValidFrom.IsZero() && !c.ValidUntil.IsZero() && !c.ValidUntil.After(c.ValidFrom) {
+		return fmt.Errorf("reading: %s calibration ends before it starts", c.Quantity)
+	}
+
+	return nil
+}
+
+// ValidAt reports whether the calibration applies at t.
+func (c Calibration) ValidAt(t time.Time) bool {
+	if !c.ValidFrom.IsZero() && t.Before(c.ValidFrom) {
+		return false
+	}
+
+	if !c.ValidUntil.IsZero() && !t.Before(c.ValidUntil) {
+		return false
+	}
+
+	return true
+}
+
+func (c Calibration) lookup(v float64) float64 {
+	n := len(c.Table)
+	if n < 2 {
+		return v
+	}
+
+	i := sort.Search(n, func(i int) bool { return c.Table[i].Raw >= v })
+	switch {
+	case i == 0:
+		i = 1
+	case i == n:
+		i = n - 1
+	}
+
+	lo, hi := c.Table[i-1], c.Table[i]
+	return lo.Value + (v-lo.Raw)*(hi.Value-lo.Value)/(hi.Raw-lo.Raw)
+}
+
+// Apply corrects a raw value.
+func (c Calibration) Apply(v float64) float64 {
+	v = c.lookup(v)
+
+	gain := c.Gain
+	if gain == 0 {
+		gain = 1
+	}
+	return v*gain + c.Offset
+}
+
+// Uncalibrated holds the values a node sent for fields that have been
+// calibrated.
+type Uncalibrated struct {
+	Temperature float32
+	Humidity    float32
+	Pressure    float32
+}
+
+// Calibrate applies the calibrations valid when the reading was taken.
+// If more than one applies to a quantity, the one that started most
+// recently wins. The values the node sent are kept in r.Raw, which is
+// nil if no calibration applied; calibrating again starts over from
+// them, so a reading can be recalibrated after the profiles change.
+func (r *Reading) Calibrate(cals []Calibration) {
+	*r = r.Uncalibrated()
+
+	if !r.HasBME280() {
+		return
+	}
+
+	chosen := map[string]Calibration{}
+	for _, c := range cals {
+		if c.Device != r.Device || !c.ValidAt(r.When) {
+			continue
+		}
+
+		if prev, ok := chosen[c.Quantity]; ok && !c.ValidFrom.After(prev.ValidFrom) {
+			continue
+		}
+		chosen[c.Quantity] = c
+	}
+
+	if len(chosen) == 0 {
+		return
+	}
+
+	r.Raw = &Uncalibrated{
+		Temperature: r.Temperature,
+		Humidity:    r.Humidity,
+		Pressure:    r.Pressure,
+	}
+
+	fields := map[string]*float32{
+		QuantityTemperature: &r.Temperature,
+		QuantityHumidity:    &r.Humidity,
+		QuantityPressure:    &r.Pressure,
+	}
+
+	for quantity, c := range chosen {
+		if v, ok := fields[quantity]; ok {
+			*v = float32(c.Apply(float64(*v)))
+		}
+	}
+}
+
+// Uncalibrated returns a copy of the reading with the values the node
+// sent.
+func (r Reading) Uncalibrated() Reading {
+	if r.Raw != nil {
+		r.Temperature = r.Raw.Temperature
+		r.Humidity = r.Raw.Humidity
+		r.Pressure = r.Raw.Pressure
+		r.Raw = nil
+	}
+	return r
+}
@@ -0,0 +1,62 @@
+package reading
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kisom/goutils/assert"
+)
+
+func TestCalibrationApply(t *testing.T) {
+	c := Calibration{Quantity: QuantityTemperature, Offset: -0.5, Gain: 2}
+	assert.NoErrorT(t, c.Validate())
+	assert.BoolT(t, c.Apply(10) == 19.5, "offset and gain")
+
+	c = Calibration{
+		Quantity: QuantityHumidity,
+		Table: []CalibrationPoint{
+			{Raw: 10, Value: 12},
+			{Raw: 50, Value: 50},
+			{Raw: 90, Value: 86},
+		},
+	}
+	assert.NoErrorT(t, c.Validate())
+	assert.BoolT(t, near(c.Apply(30), 31, 1e-9), "interpolated")
+	assert.BoolT(t, near(c.Apply(90), 86, 1e-9), "table point")
+	assert.BoolT(t, near(c.Apply(100), 95, 1e-9), "extrapolated")
+	assert.BoolT(t, near(c.Apply(0), 2.5, 1e-9), "extrapolated below")
+
+	c.Table[2].Raw = 40
+	assert.ErrorT(t, c.Validate())
+	assert.ErrorT(t, Calibration{Quantity: "co2"}.Validate())
+}
+
+func TestCalibrate(t *testing.T) {
+	r := validReading()
+	r.Device = "backyard"
+
+	installed := r.When.Add(-30 * 24 * time.Hour)
+	cals := []Calibration{
+		{Device: "backyard", Quantity: QuantityTemperature, Offset: -1},
+		{Device: "backyard", Quantity: QuantityTemperature, Offset: -0.5, ValidFrom: installed},
+		{Device: "backyard", Quantity: QuantityPressure, Offset: 100, ValidUntil: installed},
+		{Device: "frontyard", Quantity: QuantityHumidity, Offset: 5},
+	}
+
+	r.Calibrate(cals)
+	assert.BoolT(t, r.Raw != nil, "raw values kept")
+	assert.BoolT(t, r.Temperature == 21, "the latest calibration wins")
+	assert.BoolT(t, r.Raw.Temperature == 21.5, "raw temperature")
+	assert.BoolT(t, r.Pressure == 101325, "expired calibration")
+	assert.BoolT(t, r.Humidity == 45, "other device")
+	assert.BoolT(t, strings.Contains(r.String(), "calibrated from 21.50°C"), r.String())
+
+	// Recalibrating starts from the raw values.
+	cals[1].Offset = -1.5
+	r.Calibrate(cals)
+	assert.BoolT(t, r.Temperature == 20, "recalibrated")
+
+	r.Calibrate(nil)
+	assert.BoolT(t, r.Raw == nil && r.Temperature == 21.5, "calibration removed")
+}
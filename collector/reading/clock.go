@@ -0,0 +1,63 @@
+package reading
+
+import "time"
+
+// A TimeAnchor is the last trustworthy timestamp from a device,
+// together with its uptime then. As long as the device hasn't reset,
+// a later reading with a bad clock happened Uptime-anchor.Uptime
+// seconds after the anchor.
+type TimeAnchor struct {
+	When   time.Time
+	Uptime uint32
+}
+
+// TimePlausible reports whether When could be right: it isn't before
+// EarliestTime and, if the receive time is known, it's within
+// MaxClockSkew of it. Nodes send readings as soon as they take them.
+func (r Reading) TimePlausible() bool {
+	if r.When.Before(EarliestTime) {
+		return false
+	}
+
+	if r.ReceivedAt.IsZero() {
+		return true
+	}
+
+	skew := r.When.Sub(r.ReceivedAt)
+	return skew <= MaxClockSkew && skew >= -MaxClockSkew
+}
+
+// Anchor returns a TimeAnchor for the reading, or nil if its time
+// can't be trusted.
+func (r Reading) Anchor() *TimeAnchor {
+	if r.TimeCorrected || !r.TimePlausible() {
+		return nil
+	}
+	return &TimeAnchor{When: r.When, Uptime: r.Uptime}
+}
+
+// RecoverTime replaces an implausible When, e.g. after a brownout
+// reset the RTC to 2000. If the device's uptime has carried on from
+// the anchor, the time is worked out from it; otherwise the receive
+// time is used. The payload's time is kept in OriginalWhen and
+// TimeCorrected is set. It reports whether the time was replaced.
+func (r *Reading) RecoverTime(anchor *TimeAnchor) bool {
+	if r.TimeCorrected || r.ReceivedAt.IsZero() || r.TimePlausible() {
+		return false
+	}
+
+	r.OriginalWhen = r.When
+	r.TimeCorrected = true
+	r.When = r.ReceivedAt.UTC().Truncate(time.Second)
+
+	if anchor == nil || r.Uptime < anchor.Uptime {
+		// No anchor, or the device has reset since.
+		return true
+	}
+
+	when := anchor.When.Add(time.Duration(r.Uptime-anchor.Uptime) * time.Second)
+	if since := r.ReceivedAt.Sub(when); since >= 0 && since <= MaxClockSkew {
+		r.When = when
+	}
+	return true
+}
@@ -0,0 +1,46 @@
+package reading
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kisom/goutils/assert"
+)
+
+func TestRecoverTime(t *testing.T) {
+	good := validReading()
+	good.Uptime = 1000
+	anchor := good.Anchor()
+	assert.BoolT(t, anchor != nil, "anchor")
+	assert.BoolT(t, !good.RecoverTime(anchor), "plausible time is left alone")
+
+	// The RTC lost power, but the uptime carried on.
+	r := validReading()
+	brownout := time.Date(2000, 1, 1, 0, 10, 0, 0, time.UTC)
+	r.When = brownout
+	r.Uptime = 1300
+	r.ReceivedAt = good.When.Add(305 * time.Second)
+	assert.BoolT(t, r.RecoverTime(anchor), "corrected")
+	assert.BoolT(t, r.When.Equal(good.When.Add(300*time.Second)), r.When.String())
+	assert.BoolT(t, r.OriginalWhen.Equal(brownout), "original time")
+	assert.BoolT(t, r.TimeCorrected, "flag")
+	assert.BoolT(t, r.Anchor() == nil, "corrected readings aren't anchors")
+	assert.NoErrorT(t, r.Validate())
+	assert.BoolT(t, strings.Contains(r.String(), "corrected; the node sent 2000-01-01"), r.String())
+
+	// The device reset, so the uptime is no help.
+	r = validReading()
+	r.When = time.Date(2165, 6, 1, 0, 0, 0, 0, time.UTC)
+	r.Uptime = 10
+	assert.ErrorT(t, r.Validate())
+	assert.BoolT(t, r.RecoverTime(anchor), "corrected")
+	assert.BoolT(t, r.When.Equal(r.ReceivedAt.Truncate(time.Second)), "receive time")
+	assert.NoErrorT(t, r.Validate())
+
+	// Without a receive time there's nothing to go on.
+	r = validReading()
+	r.ReceivedAt = time.Time{}
+	r.When = brownout
+	assert.BoolT(t, !r.RecoverTime(nil), "no receive time")
+}
@@ -0,0 +1,73 @@
+package reading
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// The CCS811 gives meaningless results while it warms up after power
+// on, and for its first two days of operation.
+const (
+	// CCS811WarmUp matches the delay before the firmware in
+	// redenv/sensors.cpp starts using the sensor.
+	CCS811WarmUp = 1200 * time.Second
+	CCS811BurnIn = 48 * time.Hour
+)
+
+// StatusNotCalibrated is the CCS811 status the firmware sends until
+// the sensor has warmed up and been checked.
+const StatusNotCalibrated = 255
+
+// Conditioning says why a reading's CCS811 values can't be used yet.
+type Conditioning uint8
+
+const (
+	ConditioningWarmUp Conditioning = 1 << iota
+	ConditioningBurnIn
+	ConditioningNotCalibrated
+)
+
+var ErrConditioning = errors.New("sensor is conditioning")
+
+func (c Conditioning) String() string {
+	if c == 0 {
+		return "no"
+	}
+
+	var reasons []string
+	if c&ConditioningWarmUp != 0 {
+		reasons = append(reasons, "warm-up")
+	}
+	if c&ConditioningBurnIn != 0 {
+		reasons = append(reasons, "burn-in")
+	}
+	if c&ConditioningNotCalibrated != 0 {
+		reasons = append(reasons, "not calibrated")
+	}
+	return strings.Join(reasons, ",")
+}
+
+// CheckConditioning sets r.Conditioning. firstSeen is when the
+// device's CCS811 was first seen, for the burn-in; pass the zero time
+// if it isn't known. Validate flags the CO2 and TVOC of conditioning
+// readings, which keeps them out of aggregates and alerts that only
+// use valid fields.
+func (r *Reading) CheckConditioning(firstSeen time.Time) {
+	r.Conditioning = 0
+	if r.CCS811Status == StatusNotCalibrated {
+		r.Conditioning |= ConditioningNotCalibrated
+	}
+
+	if r.Hardware&HardwareCCS811 == 0 {
+		return
+	}
+
+	if time.Duration(r.Uptime)*time.Second < CCS811WarmUp {
+		r.Conditioning |= ConditioningWarmUp
+	}
+
+	if !firstSeen.IsZero() && r.When.Sub(firstSeen) < CCS811BurnIn {
+		r.Conditioning |= ConditioningBurnIn
+	}
+}
@@ -0,0 +1,38 @@
+package reading
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kisom/goutils/assert"
+)
+
+func TestConditioning(t *testing.T) {
+	r := validReading()
+	r.Uptime = 3600
+	r.CheckConditioning(r.When.Add(-72 * time.Hour))
+	assert.BoolT(t, r.Conditioning == 0, "settled sensor")
+	assert.NoErrorT(t, r.Validate())
+
+	r.Uptime = 600
+	r.CheckConditioning(time.Time{})
+	assert.BoolT(t, r.Conditioning == ConditioningWarmUp, r.Conditioning.String())
+
+	err := r.Validate()
+	assert.ErrorT(t, err)
+	assert.BoolT(t, r.Quality == FlagCO2|FlagTVOC, r.Quality.String())
+	assert.BoolT(t, errors.Is(err.(ValidationError)[0], ErrConditioning), "typed error")
+
+	r.Uptime = 3600
+	r.CheckConditioning(r.When.Add(-24 * time.Hour))
+	assert.BoolT(t, r.Conditioning == ConditioningBurnIn, r.Conditioning.String())
+
+	// Before the warm-up is over, the firmware doesn't set the
+	// CCS811 bit and sends a status of 255.
+	r.Hardware &^= HardwareCCS811
+	r.CCS811Status = StatusNotCalibrated
+	r.CheckConditioning(time.Time{})
+	assert.BoolT(t, r.Conditioning == ConditioningNotCalibrated, r.Conditioning.String())
+	assert.BoolT(t, r.Conditioning.String() == "not calibrated", r.Conditioning.String())
+}
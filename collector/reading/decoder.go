@@ -0,0 +1,231 @@
+package reading
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// A FieldDef describes a value at a fixed offset in a payload.
+type FieldDef struct {
+	Name   string `json:"name"`
+	Offset int    `json:"offset"`
+
+	// Type is one of int8, uint8, int16, uint16, int32, uint32,
+	// float32 or bool.
+	Type string `json:"type"`
+
+	// Endian is little or big; it defaults to the decoder's.
+	Endian string `json:"endian"`
+
+	// Scale converts the raw value into Unit; 0 means 1.
+	Scale float64 `json:"scale"`
+	Unit  string  `json:"unit"`
+}
+
+var fieldSizes = map[string]int{
+	"int8":    1,
+	"uint8":   1,
+	"bool":    1,
+	"int16":   2,
+	"uint16":  2,
+	"int32":   4,
+	"uint32":  4,
+	"float32": 4,
+}
+
+func byteOrder(endian string) binary.ByteOrder {
+	if endian == "big" {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+func (f FieldDef) decode(data []byte, order binary.ByteOrder) float64 {
+	var v float64
+	data = data[f.Offset:]
+
+	switch f.Type {
+	case "int8":
+		v = float64(int8(data[0]))
+	case "uint8", "bool":
+		v = float64(data[0])
+	case "int16":
+		v = float64(int16(order.Uint16(data)))
+	case "uint16":
+		v = float64(order.Uint16(data))
+	case "int32":
+		v = float64(int32(order.Uint32(data)))
+	case "uint32":
+		v = float64(order.Uint32(data))
+	case "float32":
+		v = float64(math.Float32frombits(order.Uint32(data)))
+	}
+
+	if f.Scale != 0 {
+		v *= f.Scale
+	}
+	return v
+}
+
+// A DecoderDef is a payload layout defined at runtime, which decodes
+// into the reading's Measurements. It is selected by device ID or
+// FPort, so it must list at least one of them.
+type DecoderDef struct {
+	Name string `json:"name"`
+
+	// Format is empty for payloads described by Fields, or
+	// FormatLPP for Cayenne LPP payloads, which describe themselves.
+	Format string `json:"format"`
+
+	Endian  string     `json:"endian"`
+	Devices []string   `json:"devices"`
+	Ports   []int      `json:"ports"`
+	Fields  []FieldDef `json:"fields"`
+}
+
+func (d *DecoderDef) Validate() error {
+	if d.Name == "" {
+		return fmt.Errorf("reading: decoder is missing a name")
+	}
+
+	if len(d.Devices) == 0 && len(d.Ports) == 0 {
+		return fmt.Errorf("reading: decoder %s has no devices or ports", d.Name)
+	}
+
+	switch d.Format {
+	case "":
+		if len(d.Fields) == 0 {
+			return fmt.Errorf("reading: decoder %s has no fields", d.Name)
+		}
+	case FormatLPP:
+		if len(d.Fields) != 0 {
+			return fmt.Errorf("reading: %s decoder %s can't have fields",
+				FormatLPP, d.Name)
+		}
+	default:
+		return fmt.Errorf("reading: decoder %s has unknown format %s",
+			d.Name, d.Format)
+	}
+
+	endians := []string{d.Endian}
+	for _, f := range d.Fields {
+		if f.Name == "" {
+			return fmt.Errorf("reading: decoder %s has a field with no name", d.Name)
+		}
+
+		if _, ok := fieldSizes[f.Type]; !ok {
+			return fmt.Errorf("reading: decoder %s: field %s has unknown type %s",
+				d.Name, f.Name, f.Type)
+		}
+
+		if f.Offset < 0 {
+			return fmt.Errorf("reading: decoder %s: field %s has a negative offset",
+				d.Name, f.Name)
+		}
+		endians = append(endians, f.Endian)
+	}
+
+	for _, endian := range endians {
+		if endian != "" && endian != "little" && endian != "big" {
+			return fmt.Errorf("reading: decoder %s: endian must be little or big", d.Name)
+		}
+	}
+
+	return nil
+}
+
+// Decode fills in the reading's Measurements from data.
+func (d *DecoderDef) Decode(r *Reading, data []byte) error {
+	for _, f := range d.Fields {
+		if f.Offset+fieldSizes[f.Type] > len(data) {
+			return fmt.Errorf("reading: %s payload is too short for %s (%d bytes)",
+				d.Name, f.Name, len(data))
+		}
+	}
+
+	r.Measurements = r.Measurements[:0]
+	for _, f := range d.Fields {
+		endian := f.Endian
+		if endian == "" {
+			endian = d.Endian
+		}
+
+		r.Measurements = append(r.Measurements, Measurement{
+			Name:  f.Name,
+			Value: f.decode(data, byteOrder(endian)),
+			Unit:  f.Unit,
+		})
+	}
+	return nil
+}
+
+// Layout returns the layout for the decoder. Its payloads may be any
+// length that holds all of the fields.
+func (d *DecoderDef) Layout() *Layout {
+	l := &Layout{
+		Name:    d.Name,
+		Ports:   d.Ports,
+		Devices: d.Devices,
+		Decode:  d.Decode,
+	}
+
+	if d.Format == FormatLPP {
+		l.Decode = DecodeLPP
+	}
+	return l
+}
+
+// ParseDecoders reads a decoder file, which is a JSON object with a
+// list of decoders:
+//
+//	{"decoders": [{"name": "soil/1", "ports": [2], "fields": [
+//	    {"name": "moisture", "offset": 0, "type": "uint16",
+//	     "endian": "big", "scale": 0.1, "unit": "%"}]}]}
+//
+// A Cayenne LPP decoder has a format instead of fields:
+//
+//	{"name": "lpp", "format": "cayenne-lpp", "devices": ["weather"]}
+func ParseDecoders(r io.Reader) ([]*DecoderDef, error) {
+	var file struct {
+		Decoders []*DecoderDef `json:"decoders"`
+	}
+
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, err
+	}
+
+	for _, d := range file.Decoders {
+		if err := d.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return file.Decoders, nil
+}
+
+// LoadDecoders registers the decoders in a decoder file.
+func (reg *Registry) LoadDecoders(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoders, err := ParseDecoders(f)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range decoders {
+		if err = reg.Register(d.Layout()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package reading
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kisom/goutils/assert"
+)
+
+var decoderFile = `{"decoders": [
+	{
+		"name": "soil/1",
+		"ports": [2],
+		"endian": "big",
+		"fields": [
+			{"name": "moisture", "offset": 0, "type": "uint16", "scale": 0.1, "unit": "%"},
+			{"name": "soil_temperature", "offset": 2, "type": "int16", "endian": "little", "scale": 0.01, "unit": "°C"},
+			{"name": "battery", "offset": 4, "type": "uint8", "scale": 0.1, "unit": "V"}
+		]
+	},
+	{
+		"name": "counter/1",
+		"devices": ["pulse"],
+		"fields": [{"name": "pulses", "offset": 0, "type": "uint32"}]
+	}
+]}`
+
+func TestDecoders(t *testing.T) {
+	decoders, err := ParseDecoders(strings.NewReader(decoderFile))
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, len(decoders) == 2, "decoders")
+
+	reg := NewRegistry()
+	for _, d := range decoders {
+		assert.NoErrorT(t, reg.Register(d.Layout()))
+	}
+
+	// The port decoder accepts trailing bytes.
+	data := []byte{0x01, 0xF4, 0xCC, 0xFE, 0x25, 0xFF}
+	l, err := reg.Lookup("soil", 2, data)
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, l.Name == "soil/1", "port decoder")
+
+	r := &Reading{}
+	assert.NoErrorT(t, l.Decode(r, data))
+	assert.BoolT(t, len(r.Measurements) == 3, "measurements")
+	assert.BoolT(t, r.Measurements[0].Name == "moisture", "name")
+	assert.BoolT(t, fleq(float32(r.Measurements[0].Value), 50.0), "big endian with scale")
+	assert.BoolT(t, fleq(float32(r.Measurements[1].Value), -3.08), "little endian override")
+	assert.BoolT(t, r.Measurements[2].Unit == "V", "unit")
+
+	_, err = reg.Lookup("soil", 2, data[:4])
+	assert.NoErrorT(t, err)
+	assert.ErrorT(t, l.Decode(r, data[:4]))
+
+	// The device decoder wins over the port.
+	l, err = reg.Lookup("pulse", 2, []byte{1, 0, 0, 0})
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, l.Name == "counter/1", "device decoder")
+
+	// Other devices and ports fall back to the redenv layouts.
+	_, err = reg.Lookup("soil", 1, data)
+	assert.ErrorEqT(t, ErrUnknownLayout, err)
+}
+
+func TestDecodeWithDefaultRegistry(t *testing.T) {
+	d := &DecoderDef{
+		Name:    "test/1",
+		Devices: []string{"test-decoder"},
+		Fields:  []FieldDef{{Name: "level", Type: "int8"}},
+	}
+	assert.NoErrorT(t, d.Validate())
+	assert.NoErrorT(t, DefaultRegistry.Register(d.Layout()))
+
+	received := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	r := &Reading{Device: "test-decoder", ReceivedAt: received}
+	assert.NoErrorT(t, r.Decode(1, []byte{0xFF}))
+	assert.BoolT(t, r.Layout == "test/1", "layout")
+	assert.BoolT(t, r.When.Equal(received), "payload without a timestamp")
+	assert.BoolT(t, r.Measurements[0].Value == -1, "signed value")
+
+	_, err := r.Marshal()
+	assert.ErrorT(t, err)
+}
+
+func TestDecoderValidate(t *testing.T) {
+	bad := []string{
+		`{"decoders": [{"name": "x", "fields": [{"name": "a", "type": "uint8"}]}]}`,
+		`{"decoders": [{"name": "x", "ports": [2], "fields": [{"name": "a", "type": "uint64"}]}]}`,
+		`{"decoders": [{"name": "x", "ports": [2], "endian": "middle", "fields": [{"name": "a", "type": "uint8"}]}]}`,
+		`{"decoders": [{"name": "x", "ports": [2], "fields": [{"name": "a", "type": "uint8", "offest": 1}]}]}`,
+		`{"decoders": [{"name": "x", "ports": [2]}]}`,
+	}
+
+	for _, file := range bad {
+		_, err := ParseDecoders(strings.NewReader(file))
+		assert.ErrorT(t, err, file)
+	}
+}
@@ -0,0 +1,99 @@
+package reading
+
+import "math"
+
+// The derived quantities are NaN if any of the fields they're worked
+// out from were flagged by Validate.
+
+// Magnus coefficients over water (Alduchov and Eskridge, 1996).
+const (
+	magnusA = 17.62
+	magnusB = 243.12 // °C
+	magnusC = 6.112  // hPa
+)
+
+// saturationVaporPressure returns the saturation vapour pressure in
+// hPa at t °C.
+func saturationVaporPressure(t float64) float64 {
+	return magnusC * math.Exp(magnusA*t/(magnusB+t))
+}
+
+// vaporPressure returns the actual vapour pressure in hPa.
+func (r Reading) vaporPressure() float64 {
+	return saturationVaporPressure(float64(r.Temperature)) * float64(r.Humidity) / 100
+}
+
+// DewPoint returns the dew point in °C, or NaN if the humidity is not
+// positive.
+func (r Reading) DewPoint() float64 {
+	if !r.Valid(FlagTemperature|FlagHumidity) || r.Humidity <= 0 {
+		return math.NaN()
+	}
+
+	t := float64(r.Temperature)
+	g := math.Log(float64(r.Humidity)/100) + magnusA*t/(magnusB+t)
+	return magnusB * g / (magnusA - g)
+}
+
+// HeatIndex returns the apparent temperature in °C, using the
+// National Weather Service's regression.
+func (r Reading) HeatIndex() float64 {
+	if !r.Valid(FlagTemperature | FlagHumidity) {
+		return math.NaN()
+	}
+
+	t := float64(r.Temperature)*9/5 + 32
+	rh := float64(r.Humidity)
+
+	hi := 0.5 * (t + 61 + (t-68)*1.2 + rh*0.094)
+	if (hi+t)/2 >= 80 {
+		hi = -42.379 + 2.04901523*t + 10.14333127*rh -
+			0.22475541*t*rh - 0.00683783*t*t - 0.05481717*rh*rh +
+			0.00122874*t*t*rh + 0.00085282*t*rh*rh -
+			0.00000199*t*t*rh*rh
+
+		switch {
+		case rh < 13 && t >= 80 && t <= 112:
+			hi -= (13 - rh) / 4 * math.Sqrt((17-math.Abs(t-95))/17)
+		case rh > 85 && t >= 80 && t <= 87:
+			hi += (rh - 85) / 10 * (87 - t) / 5
+		}
+	}
+
+	return (hi - 32) * 5 / 9
+}
+
+// AbsoluteHumidity returns the mass of water vapour in g/m³.
+func (r Reading) AbsoluteHumidity() float64 {
+	if !r.Valid(FlagTemperature | FlagHumidity) {
+		return math.NaN()
+	}
+
+	// 216.7 is 100 Pa/hPa * 1000 g/kg over the specific gas
+	// constant of water vapour, 461.5 J/(kg·K).
+	return 216.7 * r.vaporPressure() / (float64(r.Temperature) + 273.15)
+}
+
+// VaporPressureDeficit returns the difference between the saturation
+// and actual vapour pressures in kPa.
+func (r Reading) VaporPressureDeficit() float64 {
+	if !r.Valid(FlagTemperature | FlagHumidity) {
+		return math.NaN()
+	}
+
+	es := saturationVaporPressure(float64(r.Temperature))
+	return (es - r.vaporPressure()) / 10
+}
+
+// SeaLevelPressure returns the pressure in Pa reduced to sea level
+// from the device's elevation. It returns NaN if the elevation isn't
+// known.
+func (r Reading) SeaLevelPressure() float64 {
+	if r.Elevation == nil || !r.Valid(FlagTemperature|FlagPressure) {
+		return math.NaN()
+	}
+
+	h := *r.Elevation
+	lapse := 0.0065 * h
+	return float64(r.Pressure) * math.Pow(1-lapse/(float64(r.Temperature)+lapse+273.15), -5.257)
+}
@@ -0,0 +1,35 @@
+package reading
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/kisom/goutils/assert"
+)
+
+func near(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+func TestDerived(t *testing.T) {
+	r := Reading{Temperature: 25, Humidity: 50, Pressure: 100000}
+	assert.BoolT(t, near(r.DewPoint(), 13.85, 0.05), "dew point")
+	assert.BoolT(t, near(r.HeatIndex(), 24.86, 0.05), "heat index below 80°F")
+	assert.BoolT(t, near(r.AbsoluteHumidity(), 11.48, 0.05), "absolute humidity")
+	assert.BoolT(t, near(r.VaporPressureDeficit(), 1.58, 0.01), "VPD")
+	assert.BoolT(t, math.IsNaN(r.SeaLevelPressure()), "no elevation")
+
+	elevation := 100.0
+	r.Temperature = 15
+	r.Elevation = &elevation
+	assert.BoolT(t, near(r.SeaLevelPressure(), 101192, 10), "sea-level pressure")
+
+	// The NWS table gives 106°F for 90°F and 70%.
+	r = Reading{Temperature: 32.2222, Humidity: 70}
+	assert.BoolT(t, near(r.HeatIndex(), 41.1, 0.3), "heat index")
+
+	r.Humidity = 0
+	assert.BoolT(t, math.IsNaN(r.DewPoint()), "dew point without humidity")
+	assert.BoolT(t, strings.Contains(r.String(), "Dew point: unknown"), "unknown dew point")
+}
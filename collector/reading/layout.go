@@ -0,0 +1,156 @@
+package reading
+
+import (
+	"errors"
+	"fmt"
+)
+
+//go:generate go run ../cmd/payloadgen -schema ../schema/redenv.json -go payload_gen.go -c ../../redenv/reading.h,../../node/include/reading.h -js ../schema/redenv.js -py ../../script/redenv_layout.py
+
+// NoPort is passed as the FPort when it isn't known.
+const NoPort = -1
+
+var ErrUnknownLayout = errors.New("collector: invalid reading raw data length")
+
+// A Layout is one version of the payload sent by the nodes.
+type Layout struct {
+	Name string
+
+	// Size is the length of the payload. If it is 0, the payload
+	// may be any length and Decode checks it; such layouts can
+	// only be selected by device or FPort.
+	Size int
+
+	// If Versioned is true, the first byte of the payload is
+	// Version. Otherwise, the layout is picked by length or FPort.
+	Versioned bool
+	Version   uint8
+
+	// Ports lists FPorts that are always decoded with this layout.
+	Ports []int
+
+	// Devices lists device IDs whose payloads are always decoded
+	// with this layout, whatever the FPort.
+	Devices []string
+
+	Decode func(r *Reading, data []byte) error
+	Encode func(r *Reading) ([]byte, error)
+}
+
+// Registry selects the layout for a payload.
+type Registry struct {
+	byVersion map[uint8]*Layout
+	byPort    map[int]*Layout
+	byDevice  map[string]*Layout
+	bySize    map[int]*Layout
+	byName    map[string]*Layout
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		byVersion: map[uint8]*Layout{},
+		byPort:    map[int]*Layout{},
+		byDevice:  map[string]*Layout{},
+		bySize:    map[int]*Layout{},
+		byName:    map[string]*Layout{},
+	}
+}
+
+// Register adds a layout. Unversioned layouts are also selected by
+// their size, so two of them can't have the same size.
+func (reg *Registry) Register(l *Layout) error {
+	if _, ok := reg.byName[l.Name]; ok {
+		return fmt.Errorf("reading: layout %s is already registered", l.Name)
+	}
+
+	if l.Versioned {
+		if other, ok := reg.byVersion[l.Version]; ok {
+			return fmt.Errorf("reading: layouts %s and %s have the same version",
+				l.Name, other.Name)
+		}
+	} else if l.Size == 0 {
+		if len(l.Ports) == 0 && len(l.Devices) == 0 {
+			return fmt.Errorf("reading: layout %s has no size, ports or devices", l.Name)
+		}
+	} else if other, ok := reg.bySize[l.Size]; ok {
+		return fmt.Errorf("reading: layouts %s and %s have the same size",
+			l.Name, other.Name)
+	}
+
+	for _, port := range l.Ports {
+		if other, ok := reg.byPort[port]; ok {
+			return fmt.Errorf("reading: layouts %s and %s both claim port %d",
+				l.Name, other.Name, port)
+		}
+	}
+
+	for _, device := range l.Devices {
+		if other, ok := reg.byDevice[device]; ok {
+			return fmt.Errorf("reading: layouts %s and %s both claim device %s",
+				l.Name, other.Name, device)
+		}
+	}
+
+	reg.byName[l.Name] = l
+	if l.Versioned {
+		reg.byVersion[l.Version] = l
+	} else if l.Size != 0 {
+		reg.bySize[l.Size] = l
+	}
+
+	for _, port := range l.Ports {
+		reg.byPort[port] = l
+	}
+
+	for _, device := range l.Devices {
+		reg.byDevice[device] = l
+	}
+	return nil
+}
+
+// Layout returns the named layout, or nil.
+func (reg *Registry) Layout(name string) *Layout {
+	return reg.byName[name]
+}
+
+// Lookup picks the layout for a payload received from device on
+// port. A layout registered for the device wins, then one registered
+// for the port; then a versioned layout whose version byte and size
+// both match; then an unversioned layout of the same size.
+func (reg *Registry) Lookup(device string, port int, data []byte) (*Layout, error) {
+	l, ok := reg.byDevice[device]
+	if !ok {
+		l, ok = reg.byPort[port]
+	}
+
+	if ok {
+		if l.Size != 0 && len(data) != l.Size {
+			return nil, ErrUnknownLayout
+		}
+		return l, nil
+	}
+
+	if len(data) > 0 {
+		if l, ok := reg.byVersion[data[0]]; ok && len(data) == l.Size {
+			return l, nil
+		}
+	}
+
+	if l, ok := reg.bySize[len(data)]; ok {
+		return l, nil
+	}
+
+	return nil, ErrUnknownLayout
+}
+
+// DefaultRegistry knows the layouts sent by the firmware in this
+// repository.
+var DefaultRegistry = NewRegistry()
+
+func init() {
+	for _, l := range generatedLayouts {
+		if err := DefaultRegistry.Register(l); err != nil {
+			panic(err.Error())
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package reading
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// FormatLPP selects the Cayenne LPP decoder in a DecoderDef.
+const FormatLPP = "cayenne-lpp"
+
+// Cayenne LPP data types.
+const (
+	LPPDigitalInput  = 0
+	LPPDigitalOutput = 1
+	LPPAnalogInput   = 2
+	LPPAnalogOutput  = 3
+	LPPIlluminance   = 101
+	LPPPresence      = 102
+	LPPTemperature   = 103
+	LPPHumidity      = 104
+	LPPAccelerometer = 113
+	LPPBarometer     = 115
+	LPPVoltage       = 116
+	LPPCurrent       = 117
+	LPPFrequency     = 118
+	LPPPercentage    = 120
+	LPPAltitude      = 121
+	LPPConcentration = 125
+	LPPPower         = 128
+	LPPDistance      = 130
+	LPPEnergy        = 131
+	LPPDirection     = 132
+	LPPUnixTime      = 133
+	LPPGyrometer     = 134
+	LPPGPS           = 136
+	LPPSwitch        = 142
+)
+
+// An lppValue is one of the numbers packed into an LPP data type.
+type lppValue struct {
+	name   string
+	size   int
+	signed bool
+	scale  float64
+	unit   string
+}
+
+type lppType struct {
+	name   string
+	values []lppValue
+}
+
+func (t lppType) size() int {
+	size := 0
+	for _, v := range t.values {
+		size += v.size
+	}
+	return size
+}
+
+func lppScalar(name string, size int, signed bool, scale float64, unit string) lppType {
+	return lppType{name: name, values: []lppValue{{"", size, signed, scale, unit}}}
+}
+
+func lppAxes(name string, scale float64, unit string) lppType {
+	return lppType{name: name, values: []lppValue{
+		{"x", 2, true, scale, unit},
+		{"y", 2, true, scale, unit},
+		{"z", 2, true, scale, unit},
+	}}
+}
+
+var lppTypes = map[uint8]lppType{
+	LPPDigitalInput:  lppScalar("digital_input", 1, false, 1, ""),
+	LPPDigitalOutput: lppScalar("digital_output", 1, false, 1, ""),
+	LPPAnalogInput:   lppScalar("analog_input", 2, true, 0.01, ""),
+	LPPAnalogOutput:  lppScalar("analog_output", 2, true, 0.01, ""),
+	LPPIlluminance:   lppScalar("illuminance", 2, false, 1, "lx"),
+	LPPPresence:      lppScalar("presence", 1, false, 1, ""),
+	LPPTemperature:   lppScalar("temperature", 2, true, 0.1, "°C"),
+	LPPHumidity:      lppScalar("humidity", 1, false, 0.5, "%"),
+	LPPAccelerometer: lppAxes("accelerometer", 0.001, "G"),
+	LPPBarometer:     lppScalar("barometer", 2, false, 0.1, "hPa"),
+	LPPVoltage:       lppScalar("voltage", 2, false, 0.01, "V"),
+	LPPCurrent:       lppScalar("current", 2, false, 0.001, "A"),
+	LPPFrequency:     lppScalar("frequency", 4, false, 1, "Hz"),
+	LPPPercentage:    lppScalar("percentage", 1, false, 1, "%"),
+	LPPAltitude:      lppScalar("altitude", 2, true, 1, "m"),
+	LPPConcentration: lppScalar("concentration", 2, false, 1, "ppm"),
+	LPPPower:         lppScalar("power", 2, false, 1, "W"),
+	LPPDistance:      lppScalar("distance", 4, false, 0.001, "m"),
+	LPPEnergy:        lppScalar("energy", 4, false, 0.001, "kWh"),
+	LPPDirection:     lppScalar("direction", 2, false, 1, "°"),
+	LPPUnixTime:      lppScalar("unix_time", 4, false, 1, "s"),
+	LPPGyrometer:     lppAxes("gyrometer", 0.01, "°/s"),
+	LPPGPS: {name: "gps", values: []lppValue{
+		{"latitude", 3, true, 0.0001, "°"},
+		{"longitude", 3, true, 0.0001, "°"},
+		{"altitude", 3, true, 0.01, "m"},
+	}},
+	LPPSwitch: lppScalar("switch", 1, false, 1, ""),
+}
+
+// lppInt reads a big-endian integer of up to four bytes.
+func lppInt(data []byte, signed bool) float64 {
+	var buf [4]byte
+	copy(buf[4-len(data):], data)
+	v := binary.BigEndian.Uint32(buf[:])
+
+	if signed {
+		shift := uint(32 - 8*len(data))
+		return float64(int32(v<<shift) >> shift)
+	}
+	return float64(v)
+}
+
+// DecodeLPP decodes a Cayenne LPP payload. The first temperature,
+// humidity, barometer, GPS and time values fill in the matching
+// fields of the reading; everything else is kept in Measurements,
+// named after the type and channel, e.g. "analog_input_3". Sensor
+// fields the payload doesn't carry are marked Missing.
+func DecodeLPP(r *Reading, data []byte) error {
+	r.CO2 = -1
+	r.TVOC = -1
+	r.Missing = 0
+	r.Measurements = r.Measurements[:0]
+	seen := map[uint8]bool{}
+
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return fmt.Errorf("reading: truncated LPP payload")
+		}
+
+		channel, code := data[0], data[1]
+		t, ok := lppTypes[code]
+		if !ok {
+			return fmt.Errorf("reading: unknown LPP type %d on channel %d", code, channel)
+		}
+
+		data = data[2:]
+		if len(data) < t.size() {
+			return fmt.Errorf("reading: truncated LPP %s on channel %d", t.name, channel)
+		}
+
+		values := make([]float64, len(t.values))
+		for i, v := range t.values {
+			values[i] = lppInt(data[:v.size], v.signed) * v.scale
+			data = data[v.size:]
+		}
+
+		if !seen[code] && r.setLPP(code, values) {
+			seen[code] = true
+			continue
+		}
+
+		for i, v := range t.values {
+			name := fmt.Sprintf("%s_%d", t.name, channel)
+			if v.name != "" {
+				name = fmt.Sprintf("%s_%s_%d", t.name, v.name, channel)
+			}
+			r.Measurements = append(r.Measurements, Measurement{
+				Name:  name,
+				Value: values[i],
+				Unit:  v.unit,
+			})
+		}
+	}
+
+	if r.HasBME280() {
+		for code, field := range map[uint8]Flag{
+			LPPTemperature: FlagTemperature,
+			LPPHumidity:    FlagHumidity,
+			LPPBarometer:   FlagPressure,
+		} {
+			if !seen[code] {
+				r.Missing |= field
+			}
+		}
+	}
+
+	// LPP has no satellite count.
+	if r.HasGPS() {
+		r.Missing |= FlagGPS
+	}
+	return nil
+}
+
+// setLPP fills in the reading field matching an LPP type, and reports
+// whether there was one.
+func (r *Reading) setLPP(code uint8, values []float64) bool {
+	switch code {
+	case LPPTemperature:
+		r.Temperature = float32(values[0])
+		r.Hardware |= HardwareBME280
+	case LPPHumidity:
+		r.Humidity = float32(values[0])
+		r.Hardware |= HardwareBME280
+	case LPPBarometer:
+		// hPa to Pa, which is what the redenv nodes send.
+		r.Pressure = float32(values[0] * 100)
+		r.Hardware |= HardwareBME280
+	case LPPUnixTime:
+		r.When = time.Unix(int64(values[0]), 0).UTC()
+	case LPPGPS:
+		// The reading has nowhere to put a position, so only
+		// note the fix; the position is kept as measurements.
+		r.Fix = true
+		r.Hardware |= HardwareGPS
+		return false
+	default:
+		return false
+	}
+	return true
+}
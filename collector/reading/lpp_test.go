@@ -0,0 +1,94 @@
+package reading
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kisom/goutils/assert"
+)
+
+func TestDecodeLPP(t *testing.T) {
+	data := []byte{
+		0x01, 0x67, 0x00, 0xE1, // temperature 22.5°C on channel 1
+		0x02, 0x68, 0x50, // humidity 40% on channel 2
+		0x03, 0x73, 0x27, 0x6F, // barometer 1009.5 hPa on channel 3
+		0x04, 0x67, 0xFF, 0xD7, // temperature -4.1°C on channel 4
+		0x05, 0x02, 0xFE, 0x0C, // analog input -5.00 on channel 5
+		0x06, 0x88, 0x06, 0x76, 0x5F, 0xF2, 0x96, 0x0A, 0x00, 0x03, 0xE8, // GPS
+		0x07, 0x85, 0x5F, 0x5E, 0x10, 0x00, // unix time
+	}
+
+	r := &Reading{}
+	assert.NoErrorT(t, DecodeLPP(r, data))
+	assert.BoolT(t, fleq(r.Temperature, 22.5), "temperature")
+	assert.BoolT(t, fleq(r.Humidity, 40), "humidity")
+	assert.BoolT(t, fleq(r.Pressure, 100950), "pressure")
+	assert.BoolT(t, r.When.Equal(time.Unix(0x5F5E1000, 0)), "time")
+	assert.BoolT(t, r.Fix, "GPS fix")
+	assert.BoolT(t, r.Hardware == HardwareBME280|HardwareGPS, "hardware")
+	assert.BoolT(t, r.CO2 == -1 && r.TVOC == -1, "no CCS811")
+
+	want := map[string]float64{
+		"temperature_4":   -4.1,
+		"analog_input_5":  -5,
+		"gps_latitude_6":  42.3519,
+		"gps_longitude_6": -87.9094,
+		"gps_altitude_6":  10,
+	}
+	assert.BoolT(t, len(r.Measurements) == len(want), "measurements")
+	for _, m := range r.Measurements {
+		v, ok := want[m.Name]
+		assert.BoolT(t, ok, "unexpected measurement "+m.Name)
+		assert.BoolT(t, fleq(float32(m.Value), float32(v)), m.String())
+	}
+
+	assert.ErrorT(t, DecodeLPP(r, data[:len(data)-1]))
+	assert.ErrorT(t, DecodeLPP(r, []byte{0x01, 0xEE, 0x00}))
+}
+
+func TestDecodeLPPPartial(t *testing.T) {
+	r := &Reading{When: time.Now(), ReceivedAt: time.Now()}
+	assert.NoErrorT(t, DecodeLPP(r, []byte{0x01, 0x67, 0x00, 0xE1}))
+	assert.BoolT(t, *r.NullTemperature() == 22.5, "temperature")
+	assert.BoolT(t, r.NullHumidity() == nil && r.NullPressure() == nil, "not in the payload")
+	assert.BoolT(t, r.Missing == FlagHumidity|FlagPressure, r.Missing.String())
+
+	ve, ok := r.Validate().(ValidationError)
+	assert.BoolT(t, ok, "validation error")
+	for _, e := range ve {
+		if e.Field == FlagHumidity || e.Field == FlagPressure {
+			assert.ErrorEqT(t, e.Err, ErrMissing)
+		}
+	}
+	assert.BoolT(t, r.Valid(FlagTemperature), "temperature")
+	assert.BoolT(t, !r.Valid(FlagHumidity) && !r.Valid(FlagPressure), r.Quality.String())
+
+	// A position implies a fix, but there's no satellite count.
+	r = &Reading{}
+	assert.NoErrorT(t, DecodeLPP(r, []byte{0x06, 0x88, 0x06, 0x76, 0x5F, 0xF2, 0x96, 0x0A, 0x00, 0x03, 0xE8}))
+	assert.BoolT(t, r.NullFix() != nil && *r.NullFix(), "fix")
+	assert.BoolT(t, r.NullSats() == nil, "no satellite count")
+	assert.BoolT(t, r.NullTemperature() == nil, "no BME280")
+}
+
+func TestLPPDecoder(t *testing.T) {
+	decoders, err := ParseDecoders(strings.NewReader(
+		`{"decoders": [{"name": "lpp", "format": "cayenne-lpp", "ports": [3]}]}`))
+	assert.NoErrorT(t, err)
+
+	reg := NewRegistry()
+	assert.NoErrorT(t, reg.Register(decoders[0].Layout()))
+
+	l, err := reg.Lookup("weather", 3, []byte{0x01, 0x67, 0x00, 0xE1})
+	assert.NoErrorT(t, err)
+
+	r := &Reading{}
+	assert.NoErrorT(t, l.Decode(r, []byte{0x01, 0x67, 0x00, 0xE1}))
+	assert.BoolT(t, fleq(r.Temperature, 22.5), "temperature")
+
+	_, err = ParseDecoders(strings.NewReader(`{"decoders": [{"name": "lpp",
+		"format": "cayenne-lpp", "ports": [3],
+		"fields": [{"name": "a", "type": "uint8"}]}]}`))
+	assert.ErrorT(t, err)
+}
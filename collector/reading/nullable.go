@@ -0,0 +1,103 @@
+package reading
+
+import "fmt"
+
+// The sensor fields hold whatever the node sent, which is a zero or -1
+// when the sensor isn't fitted or has failed, or when the payload
+// didn't carry the value. The Null methods return nil in that case, so
+// that a missing value isn't mistaken for a measurement; use them for
+// anything that aggregates readings.
+
+// HasBME280 reports whether the temperature, humidity and pressure
+// were measured.
+func (r Reading) HasBME280() bool {
+	return r.Hardware&HardwareBME280 != 0
+}
+
+// HasCCS811 reports whether the CCS811 is fitted and reported no
+// error.
+func (r Reading) HasCCS811() bool {
+	return r.Hardware&HardwareCCS811 != 0 && r.CCS811Status == 0
+}
+
+// HasGPS reports whether the node has a GPS.
+func (r Reading) HasGPS() bool {
+	return r.Hardware&HardwareGPS != 0
+}
+
+func (r Reading) NullTemperature() *float32 {
+	if !r.HasBME280() || r.Missing&FlagTemperature != 0 {
+		return nil
+	}
+	v := r.Temperature
+	return &v
+}
+
+func (r Reading) NullHumidity() *float32 {
+	if !r.HasBME280() || r.Missing&FlagHumidity != 0 {
+		return nil
+	}
+	v := r.Humidity
+	return &v
+}
+
+func (r Reading) NullPressure() *float32 {
+	if !r.HasBME280() || r.Missing&FlagPressure != 0 {
+		return nil
+	}
+	v := r.Pressure
+	return &v
+}
+
+// NullCO2 also returns nil if the node didn't record a value.
+func (r Reading) NullCO2() *int32 {
+	if !r.HasCCS811() || r.CO2 == -1 {
+		return nil
+	}
+	v := r.CO2
+	return &v
+}
+
+// NullTVOC also returns nil if the node didn't record a value.
+func (r Reading) NullTVOC() *int32 {
+	if !r.HasCCS811() || r.TVOC == -1 {
+		return nil
+	}
+	v := r.TVOC
+	return &v
+}
+
+func (r Reading) NullFix() *bool {
+	if !r.HasGPS() {
+		return nil
+	}
+	v := r.Fix
+	return &v
+}
+
+func (r Reading) NullSats() *uint8 {
+	if !r.HasGPS() || r.Missing&FlagGPS != 0 {
+		return nil
+	}
+	v := r.Sats
+	return &v
+}
+
+// formatNull formats a value returned by one of the Null methods.
+func formatNull(format string, v interface{}) string {
+	switch v := v.(type) {
+	case *float32:
+		if v != nil {
+			return fmt.Sprintf(format, *v)
+		}
+	case *int32:
+		if v != nil {
+			return fmt.Sprintf(format, *v)
+		}
+	case *uint8:
+		if v != nil {
+			return fmt.Sprintf(format, *v)
+		}
+	}
+	return "not recorded"
+}
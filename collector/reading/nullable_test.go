@@ -0,0 +1,30 @@
+package reading
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kisom/goutils/assert"
+)
+
+func TestNullable(t *testing.T) {
+	r := validReading()
+	assert.BoolT(t, *r.NullTemperature() == r.Temperature, "temperature")
+	assert.BoolT(t, *r.NullCO2() == r.CO2, "CO2")
+	assert.BoolT(t, *r.NullSats() == r.Sats, "sats")
+
+	r.Hardware = HardwareCCS811
+	assert.BoolT(t, r.NullTemperature() == nil, "temperature without a BME280")
+	assert.BoolT(t, r.NullHumidity() == nil, "humidity without a BME280")
+	assert.BoolT(t, r.NullPressure() == nil, "pressure without a BME280")
+	assert.BoolT(t, r.NullFix() == nil && r.NullSats() == nil, "GPS")
+	assert.BoolT(t, strings.Contains(r.String(), "Temperature: not recorded"), "string")
+
+	r.TVOC = -1
+	assert.BoolT(t, r.NullCO2() != nil, "CO2")
+	assert.BoolT(t, r.NullTVOC() == nil, "TVOC not recorded")
+
+	r.CCS811Status = 2
+	assert.BoolT(t, r.NullCO2() == nil, "CO2 with a CCS811 error")
+	assert.BoolT(t, strings.Contains(r.String(), "CO2: not recorded"), "string")
+}
@@ -0,0 +1,136 @@
+// Code generated by payloadgen from redenv.json; DO NOT EDIT.
+
+package reading
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+const (
+	// ReadingSizeV1 is the length of a redenv/1 payload.
+	ReadingSizeV1 = 39
+
+	// ReadingSizeV2 is the length of a redenv/2 payload.
+	ReadingSizeV2 = 41
+
+	// ReadingSize is the length of the current payload.
+	ReadingSize = ReadingSizeV2
+
+	// CurrentLayout is the layout sent by the current firmware.
+	CurrentLayout = "redenv/2"
+)
+
+// Scales convert raw values into their units.
+const (
+	VoltageScale = 0.1
+)
+
+func (r *Reading) unmarshalV1(data []byte) error {
+	if len(data) != ReadingSizeV1 {
+		return ErrUnknownLayout
+	}
+
+	r.When = time.Date(int(binary.LittleEndian.Uint16(data[0:])), time.Month(data[2]),
+		int(data[3]), int(data[4]), int(data[5]), int(data[6]), 0, time.UTC)
+	r.Hardware = data[7]
+	r.Uptime = binary.LittleEndian.Uint32(data[8:])
+	r.Temperature = math.Float32frombits(binary.LittleEndian.Uint32(data[12:]))
+	r.TemperatureCalibration = math.Float32frombits(binary.LittleEndian.Uint32(data[16:]))
+	r.Humidity = math.Float32frombits(binary.LittleEndian.Uint32(data[20:]))
+	r.Pressure = math.Float32frombits(binary.LittleEndian.Uint32(data[24:]))
+	r.CO2 = int32(binary.LittleEndian.Uint32(data[28:]))
+	r.TVOC = int32(binary.LittleEndian.Uint32(data[32:]))
+	r.Voltage = data[36]
+	r.CCS811Status = data[37]
+	r.TemperatureCalibrated = data[38] == 1
+	return nil
+}
+
+func (r *Reading) marshalV1() ([]byte, error) {
+	data := make([]byte, ReadingSizeV1)
+	when := r.When.UTC()
+	binary.LittleEndian.PutUint16(data[0:], uint16(when.Year()))
+	data[2] = uint8(when.Month())
+	data[3] = uint8(when.Day())
+	data[4] = uint8(when.Hour())
+	data[5] = uint8(when.Minute())
+	data[6] = uint8(when.Second())
+	data[7] = r.Hardware
+	binary.LittleEndian.PutUint32(data[8:], r.Uptime)
+	binary.LittleEndian.PutUint32(data[12:], math.Float32bits(r.Temperature))
+	binary.LittleEndian.PutUint32(data[16:], math.Float32bits(r.TemperatureCalibration))
+	binary.LittleEndian.PutUint32(data[20:], math.Float32bits(r.Humidity))
+	binary.LittleEndian.PutUint32(data[24:], math.Float32bits(r.Pressure))
+	binary.LittleEndian.PutUint32(data[28:], uint32(r.CO2))
+	binary.LittleEndian.PutUint32(data[32:], uint32(r.TVOC))
+	data[36] = r.Voltage
+	data[37] = r.CCS811Status
+	data[38] = boolByte(r.TemperatureCalibrated)
+	return data, nil
+}
+
+func (r *Reading) unmarshalV2(data []byte) error {
+	if len(data) != ReadingSizeV2 {
+		return ErrUnknownLayout
+	}
+
+	r.When = time.Date(int(binary.LittleEndian.Uint16(data[0:])), time.Month(data[2]),
+		int(data[3]), int(data[4]), int(data[5]), int(data[6]), 0, time.UTC)
+	r.Hardware = data[7]
+	r.Uptime = binary.LittleEndian.Uint32(data[8:])
+	r.Temperature = math.Float32frombits(binary.LittleEndian.Uint32(data[12:]))
+	r.TemperatureCalibration = math.Float32frombits(binary.LittleEndian.Uint32(data[16:]))
+	r.Humidity = math.Float32frombits(binary.LittleEndian.Uint32(data[20:]))
+	r.Pressure = math.Float32frombits(binary.LittleEndian.Uint32(data[24:]))
+	r.CO2 = int32(binary.LittleEndian.Uint32(data[28:]))
+	r.TVOC = int32(binary.LittleEndian.Uint32(data[32:]))
+	r.Voltage = data[36]
+	r.CCS811Status = data[37]
+	r.TemperatureCalibrated = data[38] == 1
+	r.Fix = data[39] == 1
+	r.Sats = data[40]
+	return nil
+}
+
+func (r *Reading) marshalV2() ([]byte, error) {
+	data := make([]byte, ReadingSizeV2)
+	when := r.When.UTC()
+	binary.LittleEndian.PutUint16(data[0:], uint16(when.Year()))
+	data[2] = uint8(when.Month())
+	data[3] = uint8(when.Day())
+	data[4] = uint8(when.Hour())
+	data[5] = uint8(when.Minute())
+	data[6] = uint8(when.Second())
+	data[7] = r.Hardware
+	binary.LittleEndian.PutUint32(data[8:], r.Uptime)
+	binary.LittleEndian.PutUint32(data[12:], math.Float32bits(r.Temperature))
+	binary.LittleEndian.PutUint32(data[16:], math.Float32bits(r.TemperatureCalibration))
+	binary.LittleEndian.PutUint32(data[20:], math.Float32bits(r.Humidity))
+	binary.LittleEndian.PutUint32(data[24:], math.Float32bits(r.Pressure))
+	binary.LittleEndian.PutUint32(data[28:], uint32(r.CO2))
+	binary.LittleEndian.PutUint32(data[32:], uint32(r.TVOC))
+	data[36] = r.Voltage
+	data[37] = r.CCS811Status
+	data[38] = boolByte(r.TemperatureCalibrated)
+	data[39] = boolByte(r.Fix)
+	data[40] = r.Sats
+	return data, nil
+}
+
+// generatedLayouts are registered with the DefaultRegistry.
+var generatedLayouts = []*Layout{
+	{
+		Name:   "redenv/1",
+		Size:   ReadingSizeV1,
+		Decode: (*Reading).unmarshalV1,
+		Encode: (*Reading).marshalV1,
+	},
+	{
+		Name:   "redenv/2",
+		Size:   ReadingSizeV2,
+		Decode: (*Reading).unmarshalV2,
+		Encode: (*Reading).marshalV2,
+	},
+}
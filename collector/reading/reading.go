@@ -1,28 +1,15 @@
 package reading
 
 import (
-	"bytes"
-	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
 	"strings"
 	"time"
 
 	"github.com/kisom/redenv/collector/util"
 )
 
-const ReadingSize = 41
-
-var Timezone *time.Location
-
-func init() {
-	var err error
-	Timezone, err = time.LoadLocation("America/Los_Angeles")
-	if err != nil {
-		panic(err.Error())
-	}
-}
-
 var (
 	ErrCCS811ID            = errors.New("ccs811: invalid ID")
 	ErrCCS811I2C           = errors.New("ccs811: I2C error")
@@ -100,51 +87,157 @@ type Reading struct {
 	Voltage uint8
 	Fix     bool
 	Sats    uint8
+
+	// Layout names the payload layout the reading was decoded with.
+	Layout string
+
+	// If TimeCorrected is set, When was reconstructed by RecoverTime
+	// and OriginalWhen holds the time in the payload.
+	TimeCorrected bool
+	OriginalWhen  time.Time
+
+	// Raw holds the values the node sent, if Calibrate changed any.
+	Raw *Uncalibrated
+
+	// Quality flags the fields that failed validation.
+	Quality Flag
+
+	// Missing flags the fields the payload didn't carry although
+	// the hardware that measures them is fitted; e.g. a Cayenne LPP
+	// frame may have a temperature but no humidity. FlagGPS stands
+	// for the satellite count, as a position implies the fix.
+	Missing Flag
+
+	// Conditioning is set while the CCS811 is warming up or burning
+	// in.
+	Conditioning Conditioning
+
+	// Elevation is the device's height above sea level in metres,
+	// if it is known. It isn't part of the payload; it's set from
+	// the collector's configuration.
+	Elevation *float64
+
+	// Measurements holds values that don't have a field of their
+	// own, such as those decoded by a DecoderDef.
+	Measurements []Measurement
 }
 
-func ccs811Reading(v int32, unit string) string {
-	if v == -1 {
-		return "not recorded"
-	}
-	return fmt.Sprintf("%d %s", v, unit)
+// A Measurement is a single named value from a payload.
+type Measurement struct {
+	Name  string
+	Value float64
+	Unit  string
+}
+
+func (m Measurement) String() string {
+	return fmt.Sprintf("%s: %g %s", m.Name, m.Value, m.Unit)
 }
 
 func (r Reading) String() string {
 	uptime := time.Duration(r.Uptime) * time.Second
-	return fmt.Sprintf(`	Recorded: %s
+	out := fmt.Sprintf(`	Recorded: %s
 	Hardware: %s
 	Uptime: %s
-	Temperature: %0.2f°C
+	Temperature: %s
 	Temperature calibration: %0.2f°C
 	Temperature calibrated? %s
-	Humidity: %0.2f
-	Barometric pressure: %0.4f kPa
+	Humidity: %s
+	Barometric pressure: %s
 	CCS811 status: %s
+	CCS811 conditioning? %s
 	CO2: %s
 	TVOC: %s
 	Voltage: %0.1fV (note voltages over 10V may not be accurate)
-	Sats: %d (fix? %s)
+	Sats: %s (fix? %s)
+	Quality: %s
+	Dew point: %s
+	Heat index: %s
+	Absolute humidity: %s
+	Vapour pressure deficit: %s
+	Sea-level pressure: %s
 `,
-		r.When.In(Timezone).Format(util.TimeFormat),
+		r.recorded(),
 		r.HardwareAsString(),
 		uptime,
-		r.Temperature,
+		formatNull("%0.2f°C", r.NullTemperature())+r.rawNote(QuantityTemperature),
 		r.TemperatureCalibration,
 		util.YOrN(r.TemperatureCalibrated),
-		r.Humidity,
-		r.Pressure/1000.0,
+		formatNull("%0.2f", r.NullHumidity())+r.rawNote(QuantityHumidity),
+		pressure(r.NullPressure())+r.rawNote(QuantityPressure),
 		statusToCCS811String(r.CCS811Status),
-		ccs811Reading(r.CO2, "ppm"),
-		ccs811Reading(r.TVOC, "ppb"),
+		r.Conditioning,
+		formatNull("%d ppm", r.NullCO2()),
+		formatNull("%d ppb", r.NullTVOC()),
 		r.VoltageF(),
-		r.Sats,
+		formatNull("%d", r.NullSats()),
 		util.YOrN(r.Fix),
+		r.Quality,
+		derived(r.DewPoint(), "%0.2f°C"),
+		derived(r.HeatIndex(), "%0.2f°C"),
+		derived(r.AbsoluteHumidity(), "%0.2f g/m³"),
+		derived(r.VaporPressureDeficit(), "%0.3f kPa"),
+		derived(r.SeaLevelPressure()/1000.0, "%0.4f kPa"),
 	)
 
+	for _, m := range r.Measurements {
+		out += fmt.Sprintf("\t%s\n", m)
+	}
+	return out
+}
+
+// recorded formats When, noting whether it was corrected.
+func (r Reading) recorded() string {
+	when := r.When.In(r.Location()).Format(util.TimeFormat)
+	if !r.TimeCorrected {
+		return when
+	}
+	return fmt.Sprintf("%s (corrected; the node sent %s)", when,
+		r.OriginalWhen.In(r.Location()).Format(util.TimeFormat))
+}
+
+// rawNote notes the value the node sent for a calibrated quantity.
+func (r Reading) rawNote(quantity string) string {
+	if r.Raw == nil {
+		return ""
+	}
+
+	switch quantity {
+	case QuantityTemperature:
+		if r.Raw.Temperature != r.Temperature {
+			return fmt.Sprintf(" (calibrated from %0.2f°C)", r.Raw.Temperature)
+		}
+	case QuantityHumidity:
+		if r.Raw.Humidity != r.Humidity {
+			return fmt.Sprintf(" (calibrated from %0.2f)", r.Raw.Humidity)
+		}
+	case QuantityPressure:
+		if r.Raw.Pressure != r.Pressure {
+			return fmt.Sprintf(" (calibrated from %0.4f kPa)", r.Raw.Pressure/1000.0)
+		}
+	}
+	return ""
+}
+
+// pressure formats the pressure in kPa.
+func pressure(pa *float32) string {
+	if pa != nil {
+		kpa := *pa / 1000.0
+		pa = &kpa
+	}
+	return formatNull("%0.4f kPa", pa)
+}
+
+// derived formats a derived quantity, which is NaN if it can't be
+// worked out.
+func derived(v float64, format string) string {
+	if math.IsNaN(v) {
+		return "unknown"
+	}
+	return fmt.Sprintf(format, v)
 }
 
 func (r Reading) VoltageF() float32 {
-	return float32(r.Voltage) / 10.0
+	return float32(float64(r.Voltage) * VoltageScale)
 }
 
 func (r Reading) HardwareAsString() string {
@@ -173,106 +266,58 @@ func (r Reading) HardwareAsString() string {
 	return strings.Join(hw, ",")
 }
 
+// Unmarshal decodes a payload, picking the layout by its length.
 func (r *Reading) Unmarshal(data []byte) error {
-	if len(data) != ReadingSize {
-		return errors.New("collector: invalid reading raw data length")
-	}
-
-	buf := bytes.NewBuffer(data)
-
-	var year uint16
-	var month, day, hour, minute, second uint8
-	var calibrated uint8
-
-	read := func(value interface{}) error {
-		return binary.Read(buf, binary.LittleEndian, value)
-	}
-
-	if err := read(&year); err != nil {
-		return err
-	}
-
-	if err := read(&month); err != nil {
-		return err
-	}
-
-	if err := read(&day); err != nil {
-		return err
-	}
-
-	if err := read(&hour); err != nil {
-		return err
-	}
-
-	if err := read(&minute); err != nil {
-		return err
-	}
-
-	if err := read(&second); err != nil {
-		return err
-	}
-
-	if err := read(&r.Hardware); err != nil {
-		return err
-	}
-
-	if err := read(&r.Uptime); err != nil {
-		return err
-	}
-
-	if err := read(&r.Temperature); err != nil {
-		return err
-	}
-
-	if err := read(&r.TemperatureCalibration); err != nil {
-		return err
-	}
-
-	if err := read(&r.Humidity); err != nil {
-		return err
-	}
+	return r.Decode(NoPort, data)
+}
 
-	if err := read(&r.Pressure); err != nil {
+// Decode decodes a payload sent by r.Device on the given FPort using
+// the default registry. Payloads without a timestamp are recorded at
+// the time they were received.
+func (r *Reading) Decode(port int, data []byte) error {
+	layout, err := DefaultRegistry.Lookup(r.Device, port, data)
+	if err != nil {
 		return err
 	}
 
-	if err := read(&r.CO2); err != nil {
+	if err = layout.Decode(r, data); err != nil {
 		return err
 	}
 
-	if err := read(&r.TVOC); err != nil {
-		return err
+	if r.When.IsZero() {
+		r.When = r.ReceivedAt
 	}
 
-	if err := read(&r.Voltage); err != nil {
-		return err
-	}
+	// Problems are recorded in r.Quality rather than rejecting
+	// the payload. The burn-in can't be checked without the
+	// sensor's history, so that's left to the caller.
+	r.CheckConditioning(time.Time{})
+	r.Validate()
 
-	if err := read(&r.CCS811Status); err != nil {
-		return err
-	}
+	r.CCS811Error = statusToCCS811Error(r.CCS811Status)
+	r.Layout = layout.Name
+	return nil
+}
 
-	if err := read(&calibrated); err != nil {
-		return err
+// Marshal encodes the reading with its layout, or with the current
+// layout if it has none.
+func (r *Reading) Marshal() ([]byte, error) {
+	name := r.Layout
+	if name == "" {
+		name = CurrentLayout
 	}
 
-	if calibrated == 1 {
-		r.TemperatureCalibrated = true
+	layout := DefaultRegistry.Layout(name)
+	if layout == nil || layout.Encode == nil {
+		return nil, fmt.Errorf("reading: can't encode layout %s", name)
 	}
 
-	var fix uint8
-	if err := read(&fix); err != nil {
-		return err
-	}
-	if fix == 1 {
-		r.Fix = true
-	}
+	return layout.Encode(r)
+}
 
-	if err := read(&r.Sats); err != nil {
-		return err
+func boolByte(v bool) uint8 {
+	if v {
+		return 1
 	}
-
-	r.CCS811Error = statusToCCS811Error(r.CCS811Status)
-	r.When = time.Date(int(year), time.Month(month), int(day), int(hour), int(minute), int(second), 0, time.UTC)
-	return nil
+	return 0
 }
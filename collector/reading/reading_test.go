@@ -1,7 +1,9 @@
 package reading
 
 import (
+	"bytes"
 	"fmt"
+	"reflect"
 	"testing"
 	"time"
 
@@ -55,7 +57,7 @@ func TestUnmarshal0(t *testing.T) {
 	assert.BoolT(t, reading.Sats == 0, "GPS sats")
 
 	assert.BoolT(t, reading.HardwareAsString() == "BME280,RTC,SD", "hardware string")
-	assert.BoolT(t, fleq(reading.VoltageF(), 2.04), "voltage float", fmt.Sprintf("%f", reading.VoltageF()))
+	assert.BoolT(t, fleq(reading.VoltageF(), 20.4), "voltage float", fmt.Sprintf("%f", reading.VoltageF()))
 }
 
 func TestUnmarshal1(t *testing.T) {
@@ -92,7 +94,7 @@ func TestUnmarshal1(t *testing.T) {
 	assert.BoolT(t, reading.Sats == 0, "GPS sats")
 
 	assert.BoolT(t, reading.HardwareAsString() == "BME280,CCS811,RTC,SD", "hardware string")
-	assert.BoolT(t, fleq(reading.VoltageF(), 2.53), "voltage float", fmt.Sprintf("%f", reading.VoltageF()))
+	assert.BoolT(t, fleq(reading.VoltageF(), 25.3), "voltage float", fmt.Sprintf("%f", reading.VoltageF()))
 }
 
 func TestUnmarshal2(t *testing.T) {
@@ -129,5 +131,127 @@ func TestUnmarshal2(t *testing.T) {
 	assert.BoolT(t, reading.Sats == 7, "GPS sats")
 
 	assert.BoolT(t, reading.HardwareAsString() == "BME280,CCS811,GPS", "hardware string")
-	assert.BoolT(t, fleq(reading.VoltageF(), 1.40), "voltage float", fmt.Sprintf("%f", reading.VoltageF()))
+	assert.BoolT(t, fleq(reading.VoltageF(), 14.0), "voltage float", fmt.Sprintf("%f", reading.VoltageF()))
+}
+
+func TestUnmarshalV1(t *testing.T) {
+	// The 39-byte payload sent by the PlatformIO firmware in node/.
+	var data = []byte{
+		0xE3, 0x07, 0x0A, 0x1D, 0x0B, 0x1E, 0x04, 0x0F,
+		0xAB, 0x08, 0x00, 0x00, 0xAF, 0x47, 0x9D, 0x41,
+		0x1C, 0x85, 0xF3, 0x40, 0x00, 0xAA, 0xF4, 0x41,
+		0xC2, 0x7B, 0xC6, 0x47, 0x3F, 0x02, 0x00, 0x00,
+		0x1A, 0x00, 0x00, 0x00, 0xFD, 0x00, 0x01,
+	}
+
+	assert.BoolT(t, len(data) == ReadingSizeV1, "invalid data length")
+
+	var reading = &Reading{}
+	err := reading.Unmarshal(data)
+	assert.NoErrorT(t, err)
+
+	expectedDate := time.Date(2019, 10, 29, 11, 30, 4, 0, time.UTC)
+	assert.BoolT(t, reading.When.Equal(expectedDate), "timestamp")
+	assert.BoolT(t, reading.Layout == "redenv/1", "layout")
+	assert.BoolT(t, reading.Uptime == 2219, "uptime")
+	assert.BoolT(t, reading.CO2 == 575, "CO2")
+	assert.BoolT(t, reading.TemperatureCalibrated, "temperature calibrated")
+	assert.BoolT(t, !reading.Fix, "GPS fix")
+	assert.BoolT(t, reading.Sats == 0, "GPS sats")
+
+	err = reading.Unmarshal(data[:38])
+	assert.ErrorEqT(t, ErrUnknownLayout, err)
+}
+
+func TestRegistry(t *testing.T) {
+	decoded := ""
+	layout := func(name string) func(*Reading, []byte) error {
+		return func(*Reading, []byte) error {
+			decoded = name
+			return nil
+		}
+	}
+
+	reg := NewRegistry()
+	assert.NoErrorT(t, reg.Register(&Layout{Name: "sized", Size: 4, Decode: layout("sized")}))
+	assert.NoErrorT(t, reg.Register(&Layout{Name: "versioned", Size: 4, Versioned: true, Version: 3, Decode: layout("versioned")}))
+	assert.NoErrorT(t, reg.Register(&Layout{Name: "port", Size: 2, Ports: []int{7}, Decode: layout("port")}))
+	assert.ErrorT(t, reg.Register(&Layout{Name: "duplicate", Size: 4}))
+
+	l, err := reg.Lookup("", 1, []byte{3, 0, 0, 0})
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, l.Name == "versioned", "version byte should win over size")
+
+	l, err = reg.Lookup("", 1, []byte{2, 0, 0, 0})
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, l.Name == "sized", "size")
+
+	l, err = reg.Lookup("", 7, []byte{3, 0})
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, l.Name == "port", "port should win")
+
+	_, err = reg.Lookup("", 7, []byte{3, 0, 0, 0})
+	assert.ErrorEqT(t, ErrUnknownLayout, err)
+
+	assert.NoErrorT(t, l.Decode(&Reading{}, nil))
+	assert.BoolT(t, decoded == "port", "decoder")
+}
+
+func TestMarshal(t *testing.T) {
+	var data = []byte{
+		0xE3, 0x07, 0x0B, 0x04, 0x06, 0x19, 0x09, 0x13,
+		0xFE, 0x06, 0x00, 0x00, 0x00, 0x00, 0xBC, 0x41,
+		0x67, 0x66, 0x2A, 0xC1, 0x00, 0xCD, 0xB2, 0x42,
+		0xB3, 0x84, 0xC6, 0x47, 0x48, 0x08, 0x00, 0x00,
+		0x06, 0x01, 0x00, 0x00, 0x8C, 0x00, 0x01, 0x01,
+		0x07,
+	}
+
+	var reading = &Reading{}
+	err := reading.Unmarshal(data)
+	assert.NoErrorT(t, err)
+
+	out, err := reading.Marshal()
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, bytes.Equal(data, out), "marshaled payload should match the original")
+
+	reading.Layout = "redenv/1"
+	out, err = reading.Marshal()
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, bytes.Equal(data[:ReadingSizeV1], out), "redenv/1 payload")
+
+	reading.Layout = "unknown"
+	_, err = reading.Marshal()
+	assert.ErrorT(t, err)
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	original := Reading{
+		When:                   time.Date(2020, 2, 29, 23, 59, 58, 0, time.UTC),
+		Hardware:               HardwareBME280 | HardwareCCS811 | HardwareGPS,
+		Uptime:                 86401,
+		Temperature:            -3.25,
+		TemperatureCalibration: 1.5,
+		TemperatureCalibrated:  true,
+		Humidity:               99.5,
+		Pressure:               98765.5,
+		CCS811Status:           0,
+		CO2:                    400,
+		TVOC:                   -1,
+		Voltage:                84,
+		Fix:                    true,
+		Sats:                   9,
+	}
+
+	data, err := original.Marshal()
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, len(data) == ReadingSize, "marshaled length")
+
+	var decoded Reading
+	err = decoded.Unmarshal(data)
+	assert.NoErrorT(t, err)
+
+	original.Layout = CurrentLayout
+	original.Validate()
+	assert.BoolT(t, reflect.DeepEqual(decoded, original), "round trip should be lossless")
 }
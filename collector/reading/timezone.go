@@ -0,0 +1,50 @@
+package reading
+
+import (
+	"sync"
+	"time"
+)
+
+// Timezone is the zone readings are displayed in, unless their device
+// has one of its own. It defaults to UTC.
+var Timezone = time.UTC
+
+var deviceTimezones = struct {
+	sync.RWMutex
+	zones map[string]*time.Location
+}{zones: map[string]*time.Location{}}
+
+// LoadTimezone looks up a zone by name. If it can't be found, for
+// example because the system has no tzdata, UTC is returned along
+// with the error so that the caller can decide whether to carry on.
+func LoadTimezone(name string) (*time.Location, error) {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC, err
+	}
+	return loc, nil
+}
+
+// SetDeviceTimezone sets the zone a device's readings are displayed
+// in.
+func SetDeviceTimezone(device string, loc *time.Location) {
+	deviceTimezones.Lock()
+	defer deviceTimezones.Unlock()
+	deviceTimezones.zones[device] = loc
+}
+
+// DeviceTimezone returns the zone a device's readings are displayed
+// in.
+func DeviceTimezone(device string) *time.Location {
+	deviceTimezones.RLock()
+	defer deviceTimezones.RUnlock()
+	if loc, ok := deviceTimezones.zones[device]; ok {
+		return loc
+	}
+	return Timezone
+}
+
+// Location returns the zone the reading is displayed in.
+func (r Reading) Location() *time.Location {
+	return DeviceTimezone(r.Device)
+}
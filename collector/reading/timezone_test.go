@@ -0,0 +1,23 @@
+package reading
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kisom/goutils/assert"
+)
+
+func TestTimezone(t *testing.T) {
+	loc, err := LoadTimezone("Not/A_Zone")
+	assert.ErrorT(t, err)
+	assert.BoolT(t, loc == time.UTC, "fallback to UTC")
+
+	r := validReading()
+	r.Device = "tz-test"
+	assert.BoolT(t, r.Location() == Timezone, "default zone")
+	assert.BoolT(t, strings.Contains(r.String(), "Recorded: 2026-10-17 12:00:00 UTC"), r.String())
+
+	SetDeviceTimezone(r.Device, time.FixedZone("PDT", -7*3600))
+	assert.BoolT(t, strings.Contains(r.String(), "Recorded: 2026-10-17 05:00:00 PDT"), r.String())
+}
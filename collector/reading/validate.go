@@ -0,0 +1,186 @@
+package reading
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Flag marks fields of a reading that shouldn't be trusted; the
+// reading's Quality has a bit set for each of them.
+type Flag uint16
+
+const (
+	FlagTime Flag = 1 << iota
+	FlagTemperature
+	FlagHumidity
+	FlagPressure
+	FlagCO2
+	FlagTVOC
+	FlagGPS
+)
+
+var flagNames = []struct {
+	flag Flag
+	name string
+}{
+	{FlagTime, "time"},
+	{FlagTemperature, "temperature"},
+	{FlagHumidity, "humidity"},
+	{FlagPressure, "pressure"},
+	{FlagCO2, "co2"},
+	{FlagTVOC, "tvoc"},
+	{FlagGPS, "gps"},
+}
+
+func (f Flag) String() string {
+	if f == 0 {
+		return "OK"
+	}
+
+	var names []string
+	for _, fn := range flagNames {
+		if f&fn.flag != 0 {
+			names = append(names, fn.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+var (
+	ErrSensorAbsent = errors.New("sensor is not present")
+	ErrSensorFault  = errors.New("sensor reported an error")
+	ErrOutOfRange   = errors.New("value is outside the sensor's range")
+	ErrBadTime      = errors.New("timestamp is implausible")
+	ErrMissing      = errors.New("value is not in the payload")
+)
+
+// Physical limits of the sensors on the redenv nodes.
+const (
+	// BME280
+	MinTemperature float32 = -40 // °C
+	MaxTemperature float32 = 85
+	MinHumidity    float32 = 0 // %
+	MaxHumidity    float32 = 100
+	MinPressure    float32 = 30000 // Pa
+	MaxPressure    float32 = 110000
+
+	// CCS811
+	MinCO2  int32 = 400 // ppm
+	MaxCO2  int32 = 8192
+	MinTVOC int32 = 0 // ppb
+	MaxTVOC int32 = 1187
+)
+
+// EarliestTime is the earliest plausible timestamp. An RTC that has
+// lost power starts in 2000.
+var EarliestTime = time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// MaxClockSkew is how far from the time it was received a reading may
+// claim to have been taken.
+const MaxClockSkew = 24 * time.Hour
+
+// A FieldError explains why a field was flagged.
+type FieldError struct {
+	Field Flag
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("reading: %s: %s", e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error { return e.Err }
+
+// ValidationError lists the problems found with a reading.
+type ValidationError []*FieldError
+
+func (ve ValidationError) Error() string {
+	msgs := make([]string, 0, len(ve))
+	for _, e := range ve {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate checks each field against the sensor's limits and the
+// Hardware bitmask, and sets Quality to the fields that failed. A
+// ValidationError describing them is returned, but the reading is
+// still usable: only the flagged fields should be ignored.
+func (r *Reading) Validate() error {
+	var ve ValidationError
+	flag := func(field Flag, err error) {
+		ve = append(ve, &FieldError{Field: field, Err: err})
+	}
+
+	if !r.TimePlausible() {
+		flag(FlagTime, ErrBadTime)
+	}
+
+	if r.Hardware&HardwareBME280 == 0 {
+		flag(FlagTemperature, ErrSensorAbsent)
+		flag(FlagHumidity, ErrSensorAbsent)
+		flag(FlagPressure, ErrSensorAbsent)
+	} else {
+		switch {
+		case r.Missing&FlagTemperature != 0:
+			flag(FlagTemperature, ErrMissing)
+		case r.Temperature < MinTemperature || r.Temperature > MaxTemperature:
+			flag(FlagTemperature, ErrOutOfRange)
+		}
+
+		switch {
+		case r.Missing&FlagHumidity != 0:
+			flag(FlagHumidity, ErrMissing)
+		case r.Humidity < MinHumidity || r.Humidity > MaxHumidity:
+			flag(FlagHumidity, ErrOutOfRange)
+		}
+
+		switch {
+		case r.Missing&FlagPressure != 0:
+			flag(FlagPressure, ErrMissing)
+		case r.Pressure < MinPressure || r.Pressure > MaxPressure:
+			flag(FlagPressure, ErrOutOfRange)
+		}
+	}
+
+	switch {
+	case r.Conditioning != 0:
+		flag(FlagCO2, ErrConditioning)
+		flag(FlagTVOC, ErrConditioning)
+	case r.Hardware&HardwareCCS811 == 0:
+		flag(FlagCO2, ErrSensorAbsent)
+		flag(FlagTVOC, ErrSensorAbsent)
+	case r.CCS811Status != 0:
+		flag(FlagCO2, ErrSensorFault)
+		flag(FlagTVOC, ErrSensorFault)
+	default:
+		if r.CO2 < MinCO2 || r.CO2 > MaxCO2 {
+			flag(FlagCO2, ErrOutOfRange)
+		}
+
+		if r.TVOC < MinTVOC || r.TVOC > MaxTVOC {
+			flag(FlagTVOC, ErrOutOfRange)
+		}
+	}
+
+	if r.Hardware&HardwareGPS == 0 && (r.Fix || r.Sats != 0) {
+		flag(FlagGPS, ErrSensorAbsent)
+	}
+
+	r.Quality = 0
+	for _, e := range ve {
+		r.Quality |= e.Field
+	}
+
+	if len(ve) == 0 {
+		return nil
+	}
+	return ve
+}
+
+// Valid reports whether none of the given fields were flagged.
+func (r Reading) Valid(fields Flag) bool {
+	return r.Quality&fields == 0
+}
@@ -0,0 +1,70 @@
+package reading
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kisom/goutils/assert"
+)
+
+func validReading() *Reading {
+	return &Reading{
+		ReceivedAt:   time.Date(2026, 10, 17, 12, 0, 5, 0, time.UTC),
+		When:         time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC),
+		Hardware:     HardwareBME280 | HardwareCCS811 | HardwareGPS,
+		Temperature:  21.5,
+		Humidity:     45,
+		Pressure:     101325,
+		CO2:          415,
+		TVOC:         3,
+		CCS811Status: 0,
+		Fix:          true,
+		Sats:         7,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	r := validReading()
+	assert.NoErrorT(t, r.Validate())
+	assert.BoolT(t, r.Quality == 0, "quality")
+	assert.BoolT(t, r.Quality.String() == "OK", r.Quality.String())
+
+	r.Humidity = 100.5
+	r.Pressure = 0
+	r.When = time.Date(2000, 1, 1, 0, 3, 0, 0, time.UTC)
+	err := r.Validate()
+	assert.ErrorT(t, err)
+	assert.BoolT(t, r.Quality == FlagHumidity|FlagPressure|FlagTime, r.Quality.String())
+	assert.BoolT(t, errors.Is(err.(ValidationError)[0], ErrBadTime), "typed error")
+	assert.BoolT(t, r.Valid(FlagTemperature), "temperature is still usable")
+	assert.BoolT(t, math.IsNaN(r.DewPoint()), "no dew point from a bad humidity")
+
+	r = validReading()
+	r.When = r.ReceivedAt.Add(48 * time.Hour)
+	assert.ErrorT(t, r.Validate())
+	assert.BoolT(t, r.Quality == FlagTime, "reading from the future")
+}
+
+func TestValidateHardware(t *testing.T) {
+	r := validReading()
+	r.Hardware = HardwareCCS811
+	err := r.Validate()
+	assert.ErrorT(t, err)
+	assert.BoolT(t, r.Quality == FlagTemperature|FlagHumidity|FlagPressure|FlagGPS,
+		r.Quality.String())
+	for _, e := range err.(ValidationError) {
+		assert.BoolT(t, errors.Is(e, ErrSensorAbsent), e.Error())
+	}
+
+	r = validReading()
+	r.CCS811Status = 4
+	assert.ErrorT(t, r.Validate())
+	assert.BoolT(t, r.Quality == FlagCO2|FlagTVOC, "CCS811 fault")
+
+	r = validReading()
+	r.CO2 = -1
+	assert.ErrorT(t, r.Validate())
+	assert.BoolT(t, r.Quality == FlagCO2, "CO2 not recorded")
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/kisom/redenv/collector/reading"
+	"github.com/kisom/redenv/collector/storage"
+)
+
+const reprocessUsage = `usage: collector [-f config] reprocess [-n] [-from time] [-to time] device
+
+Decodes the payloads the device sent between from and to again, with
+the current decoders and calibrations, and stores the readings in place
+of the old ones. Readings whose payloads no longer decode are
+deleted. Times are RFC 3339 or YYYY-MM-DD in the collector's
+timezone; to is exclusive. By default every stored uplink is
+reprocessed. With -n, the changes are reported but nothing is
+written.`
+
+// parseTime parses a reprocess time, which is either RFC 3339 or a
+// date in the collector's timezone.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", s, reading.Timezone)
+	if err != nil {
+		return t, fmt.Errorf("collector: bad time %s", s)
+	}
+	return t, nil
+}
+
+// nullString formats a value that may be missing.
+func nullString(v interface{}) string {
+	rv := reflect.ValueOf(v)
+	if rv.IsNil() {
+		return "null"
+	}
+
+	if f, ok := rv.Elem().Interface().(float32); ok {
+		return fmt.Sprintf("%0.2f", f)
+	}
+	return fmt.Sprint(rv.Elem().Interface())
+}
+
+// derivedString formats a derived quantity, which is NaN if it
+// couldn't be worked out.
+func derivedString(v float64) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "null"
+	}
+	return fmt.Sprintf("%0.2f", v)
+}
+
+// readingValues lists what's stored for a reading, in the order it's
+// reported in.
+func readingValues(r *reading.Reading, d storage.Derived) [][2]string {
+	when := r.When.In(r.Location()).Format(timeFormat)
+	if r.TimeCorrected {
+		when += " (corrected)"
+	}
+
+	return [][2]string{
+		{"time", when},
+		{"layout", r.Layout},
+		{"temperature", nullString(r.NullTemperature())},
+		{"humidity", nullString(r.NullHumidity())},
+		{"pressure", nullString(r.NullPressure())},
+		{"calibrated", fmt.Sprint(r.Raw != nil)},
+		{"co2", nullString(r.NullCO2())},
+		{"tvoc", nullString(r.NullTVOC())},
+		{"voltage", fmt.Sprintf("%0.1f", r.VoltageF())},
+		{"fix", nullString(r.NullFix())},
+		{"sats", nullString(r.NullSats())},
+		{"quality", r.Quality.String()},
+		{"conditioning", r.Conditioning.String()},
+		{"elevation", nullString(r.Elevation)},
+		{"dew point", derivedString(d.DewPoint)},
+		{"heat index", derivedString(d.HeatIndex)},
+		{"absolute humidity", derivedString(d.AbsoluteHumidity)},
+		{"vapour pressure deficit", derivedString(d.VaporPressureDeficit)},
+		{"sea-level pressure", derivedString(d.SeaLevelPressure)},
+		{"measurements", fmt.Sprint(r.Measurements)},
+	}
+}
+
+// readingChanges describes how a reprocessed reading differs from the
+// stored one, including the quantities derived from it.
+func readingChanges(old *storage.StoredReading, r *reading.Reading) []string {
+	var changes []string
+	before := readingValues(old.Reading, old.Derived)
+	after := readingValues(r, storage.Derive(r))
+	for i := range before {
+		if before[i][1] != after[i][1] {
+			changes = append(changes, fmt.Sprintf("%s %s -> %s",
+				before[i][0], before[i][1], after[i][1]))
+		}
+	}
+	return changes
+}
+
+// reprocess decodes a device's stored uplinks again and replaces their
+// readings, all in one transaction.
+func reprocess(args []string) error {
+	fs := flag.NewFlagSet("reprocess", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	dryRun := fs.Bool("n", false, "")
+	fromArg := fs.String("from", "", "")
+	toArg := fs.String("to", "", "")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errors.New(reprocessUsage)
+	}
+	device := fs.Arg(0)
+
+	var err error
+	from, to := time.Unix(0, 0), time.Now().Add(time.Second)
+	if *fromArg != "" {
+		if from, err = parseTime(*fromArg); err != nil {
+			return err
+		}
+	}
+
+	if *toArg != "" {
+		if to, err = parseTime(*toArg); err != nil {
+			return err
+		}
+	}
+
+	uplinks, err := store.Uplinks(device, from, to)
+	if err != nil {
+		return err
+	}
+
+	// Sensors seen for the first time are taken as first seen in
+	// the earliest reading that has them, and are only recorded
+	// along with the readings.
+	var sensors []storage.Sensor
+	seen := map[string]time.Time{}
+	firstSeen := func(device, sensor string, when time.Time) (time.Time, error) {
+		if t, ok := seen[sensor]; ok {
+			return t, nil
+		}
+
+		t, err := store.SensorSeen(device, sensor)
+		if err == storage.ErrNotFound {
+			t = time.Unix(when.Unix(), 0)
+			sensors = append(sensors, storage.Sensor{Device: device, Sensor: sensor, FirstSeen: t})
+		} else if err != nil {
+			return t, err
+		}
+
+		seen[sensor] = t
+		return t, nil
+	}
+
+	var replaced []*reading.Reading
+	var removed []string
+	var created, updated, unchanged, undecoded int
+
+	// Times are recovered from the uplinks being reprocessed, rather
+	// than from whatever the collector saw last.
+	var anchor *reading.TimeAnchor
+	for _, su := range uplinks {
+		label := fmt.Sprintf("uplink %d @ %s", su.Uplink.Counter,
+			su.ReceivedAt.In(reading.DeviceTimezone(device)).Format(timeFormat))
+
+		r, decodeErr := su.Uplink.ToReading()
+		if decodeErr != nil {
+			undecoded++
+			_, err = store.ReadingFor(su.ID)
+			if err == storage.ErrNotFound {
+				fmt.Printf("%s: can't decode: %s\n", label, decodeErr)
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			fmt.Printf("%s: can't decode: %s; stored reading removed\n", label, decodeErr)
+			removed = append(removed, su.ID)
+			continue
+		}
+
+		r.Uplink = su.ID
+		config.Device(device).Apply(r)
+		if !r.RecoverTime(anchor) {
+			if a := r.Anchor(); a != nil {
+				anchor = a
+			}
+		}
+
+		if err = prepareReading(r, firstSeen); err != nil {
+			return err
+		}
+
+		old, err := store.ReadingFor(su.ID)
+		if err == storage.ErrNotFound {
+			fmt.Printf("%s: new reading\n", label)
+			created++
+		} else if err != nil {
+			return err
+		} else {
+			r.ID = old.ID
+			changes := readingChanges(old, r)
+			if len(changes) == 0 {
+				unchanged++
+				continue
+			}
+
+			fmt.Printf("%s: %s\n", label, strings.Join(changes, "; "))
+			updated++
+		}
+
+		replaced = append(replaced, r)
+	}
+
+	fmt.Printf("%d uplinks: %d new readings, %d updated, %d unchanged, %d can't be decoded (%d readings removed)\n",
+		len(uplinks), created, updated, unchanged, undecoded, len(removed))
+	if *dryRun {
+		fmt.Println("nothing was stored (-n)")
+		return nil
+	}
+
+	if len(replaced) == 0 && len(removed) == 0 && len(sensors) == 0 {
+		return nil
+	}
+	return store.ReplaceReadings(replaced, removed, sensors)
+}
@@ -0,0 +1,107 @@
+// Code generated by payloadgen from redenv.json; DO NOT EDIT.
+//
+// The reading packed by the redenv firmware and sent on FPort 1.
+// The layout is picked by the payload's length.
+
+function u16(b, i) {
+	return b[i] | (b[i + 1] << 8);
+}
+
+function u32(b, i) {
+	return (b[i] | (b[i + 1] << 8) | (b[i + 2] << 16) | (b[i + 3] << 24)) >>> 0;
+}
+
+function i32(b, i) {
+	return u32(b, i) | 0;
+}
+
+function f32(b, i) {
+	var bits = u32(b, i);
+	var sign = (bits >>> 31) ? -1 : 1;
+	var exp = (bits >>> 23) & 0xff;
+	var frac = bits & 0x7fffff;
+
+	if (exp === 0xff) {
+		return frac ? NaN : sign * Infinity;
+	}
+	if (exp === 0) {
+		return sign * frac * Math.pow(2, -149);
+	}
+	return sign * (1 + frac / 0x800000) * Math.pow(2, exp - 127);
+}
+
+function pad(n) {
+	return (n < 10 ? "0" : "") + n;
+}
+
+// sensor returns null for a value from a sensor that isn't present,
+// or that the node didn't record.
+function sensor(present, v, missing) {
+	return present && v !== missing ? v : null;
+}
+
+function datetime(b, i) {
+	return u16(b, i) + "-" + pad(b[i + 2]) + "-" + pad(b[i + 3]) + "T" +
+		pad(b[i + 4]) + ":" + pad(b[i + 5]) + ":" + pad(b[i + 6]) + "Z";
+}
+
+var layouts = {
+	39: function (b) {
+		return {
+			layout: "redenv/1",
+			when: datetime(b, 0),
+			hardware: b[7],
+			uptime: u32(b, 8),
+			temperature: sensor((b[7] & 1), f32(b, 12)),
+			temperature_cal: f32(b, 16),
+			humidity: sensor((b[7] & 1), f32(b, 20)),
+			pressure: sensor((b[7] & 1), f32(b, 24)),
+			co2: sensor((b[7] & 2) && b[37] === 0, i32(b, 28), -1),
+			tvoc: sensor((b[7] & 2) && b[37] === 0, i32(b, 32), -1),
+			voltage: b[36] / 10,
+			ccs811_status: b[37],
+			temperature_is_cal: b[38] === 1
+		};
+	},
+	41: function (b) {
+		return {
+			layout: "redenv/2",
+			when: datetime(b, 0),
+			hardware: b[7],
+			uptime: u32(b, 8),
+			temperature: sensor((b[7] & 1), f32(b, 12)),
+			temperature_cal: f32(b, 16),
+			humidity: sensor((b[7] & 1), f32(b, 20)),
+			pressure: sensor((b[7] & 1), f32(b, 24)),
+			co2: sensor((b[7] & 2) && b[37] === 0, i32(b, 28), -1),
+			tvoc: sensor((b[7] & 2) && b[37] === 0, i32(b, 32), -1),
+			voltage: b[36] / 10,
+			ccs811_status: b[37],
+			temperature_is_cal: b[38] === 1,
+			fix: sensor((b[7] & 16), b[39] === 1),
+			sats: sensor((b[7] & 16), b[40])
+		};
+	}
+};
+
+function decode(bytes) {
+	var layout = layouts[bytes.length];
+	if (!layout) {
+		return null;
+	}
+	return layout(bytes);
+}
+
+// Decoder is the TTN v2 payload function.
+function Decoder(bytes, port) {
+	return decode(bytes) || {};
+}
+
+// decodeUplink is the TTN v3 and ChirpStack v4 codec.
+function decodeUplink(input) {
+	var data = decode(input.bytes);
+	if (!data) {
+		return {errors: ["unknown payload length " + input.bytes.length]};
+	}
+	return {data: data};
+}
@@ -0,0 +1,216 @@
+// Package schema describes the byte layout of node payloads. The
+// redenv payload is described in redenv.json, from which payloadgen
+// generates the Go decoder, the firmware's C struct and a JavaScript
+// payload formatter.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Field types.
+const (
+	Uint8    = "uint8"
+	Uint16   = "uint16"
+	Uint32   = "uint32"
+	Int32    = "int32"
+	Float32  = "float32"
+	Bool     = "bool"
+	DateTime = "datetime"
+)
+
+var typeSizes = map[string]int{
+	Uint8:   1,
+	Uint16:  2,
+	Uint32:  4,
+	Int32:   4,
+	Float32: 4,
+	Bool:    1,
+
+	// A uint16 year followed by a uint8 each for the month, day,
+	// hour, minute and second.
+	DateTime: 7,
+}
+
+// Field is a single value in a payload.
+type Field struct {
+	// Name is the field's name in the C struct.
+	Name string `json:"name"`
+	Type string `json:"type"`
+
+	// Go is the reading.Reading field it decodes into, if any.
+	Go string `json:"go"`
+
+	// JSON is the name used by the payload formatter; it defaults
+	// to Name.
+	JSON string `json:"json"`
+
+	Unit string `json:"unit"`
+
+	// Scale converts the raw value into Unit; 0 means 1.
+	Scale float64 `json:"scale"`
+
+	// Since is the first version of the payload with this field.
+	Since int `json:"since"`
+
+	Comment string `json:"comment"`
+
+	// Sensor names the entry in the schema's Sensors that must be
+	// present for the field to have a value.
+	Sensor string `json:"sensor"`
+
+	// Missing is a raw value meaning the node didn't record one.
+	Missing *float64 `json:"missing"`
+}
+
+// A Sensor is a piece of hardware the node reports in its hardware
+// bitmask.
+type Sensor struct {
+	Bit uint8 `json:"bit"`
+
+	// Status names a field that is 0 when the sensor is working.
+	Status string `json:"status"`
+}
+
+// Size returns the encoded size of the field.
+func (f Field) Size() int {
+	return typeSizes[f.Type]
+}
+
+// JSONName returns the name the payload formatter uses.
+func (f Field) JSONName() string {
+	if f.JSON != "" {
+		return f.JSON
+	}
+	return f.Name
+}
+
+// Schema is a versioned payload layout.
+type Schema struct {
+	Name     string  `json:"name"`
+	Comment  string  `json:"comment"`
+	Endian   string  `json:"endian"`
+	Versions []int   `json:"versions"`
+	Fields   []Field `json:"fields"`
+
+	// Hardware names the field holding the bitmask of the
+	// sensors that are fitted.
+	Hardware string            `json:"hardware"`
+	Sensors  map[string]Sensor `json:"sensors"`
+}
+
+// Parse reads a schema and checks it.
+func Parse(r io.Reader) (*Schema, error) {
+	s := &Schema{}
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(s); err != nil {
+		return nil, err
+	}
+
+	return s, s.Validate()
+}
+
+// Load reads a schema from a file.
+func Load(path string) (*Schema, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+func (s *Schema) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("schema: missing name")
+	}
+
+	if s.Endian != "little" && s.Endian != "big" {
+		return fmt.Errorf("schema: %s: endian must be little or big", s.Name)
+	}
+
+	if len(s.Versions) == 0 {
+		return fmt.Errorf("schema: %s: no versions", s.Name)
+	}
+
+	seen := map[string]bool{}
+	for _, f := range s.Fields {
+		if f.Name == "" {
+			return fmt.Errorf("schema: %s: field is missing a name", s.Name)
+		}
+
+		if seen[f.Name] {
+			return fmt.Errorf("schema: %s: duplicate field %s", s.Name, f.Name)
+		}
+		seen[f.Name] = true
+
+		if _, ok := typeSizes[f.Type]; !ok {
+			return fmt.Errorf("schema: %s: field %s has unknown type %s",
+				s.Name, f.Name, f.Type)
+		}
+
+		if _, ok := s.Sensors[f.Sensor]; f.Sensor != "" && !ok {
+			return fmt.Errorf("schema: %s: field %s has unknown sensor %s",
+				s.Name, f.Name, f.Sensor)
+		}
+	}
+
+	if len(s.Sensors) > 0 && !seen[s.Hardware] {
+		return fmt.Errorf("schema: %s: sensors need a hardware field", s.Name)
+	}
+
+	for name, sensor := range s.Sensors {
+		if sensor.Status != "" && !seen[sensor.Status] {
+			return fmt.Errorf("schema: %s: sensor %s has unknown status field %s",
+				s.Name, name, sensor.Status)
+		}
+	}
+
+	return nil
+}
+
+// Current returns the latest version.
+func (s *Schema) Current() int {
+	return s.Versions[len(s.Versions)-1]
+}
+
+// LayoutName names a version of the schema, e.g. "redenv/2".
+func (s *Schema) LayoutName(version int) string {
+	return fmt.Sprintf("%s/%d", s.Name, version)
+}
+
+// FieldsFor returns the fields present in a version.
+func (s *Schema) FieldsFor(version int) []Field {
+	var fields []Field
+	for _, f := range s.Fields {
+		if f.Since <= version {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// Offsets returns the offset of each field in a version.
+func (s *Schema) Offsets(version int) map[string]int {
+	offsets := map[string]int{}
+	off := 0
+	for _, f := range s.FieldsFor(version) {
+		offsets[f.Name] = off
+		off += f.Size()
+	}
+	return offsets
+}
+
+// Size returns the encoded size of a version.
+func (s *Schema) Size(version int) int {
+	size := 0
+	for _, f := range s.FieldsFor(version) {
+		size += f.Size()
+	}
+	return size
+}
@@ -0,0 +1,42 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kisom/goutils/assert"
+)
+
+func TestRedenv(t *testing.T) {
+	s, err := Load("redenv.json")
+	assert.NoErrorT(t, err)
+
+	assert.BoolT(t, s.Current() == 2, "current version")
+	assert.BoolT(t, s.LayoutName(1) == "redenv/1", s.LayoutName(1))
+	assert.BoolT(t, s.Size(1) == 39, "v1 size")
+	assert.BoolT(t, s.Size(2) == 41, "v2 size")
+	assert.BoolT(t, len(s.FieldsFor(2))-len(s.FieldsFor(1)) == 2, "GPS fields")
+}
+
+func TestValidate(t *testing.T) {
+	_, err := Parse(strings.NewReader(`{"name": "x", "endian": "middle", "versions": [1]}`))
+	assert.ErrorT(t, err)
+
+	_, err = Parse(strings.NewReader(`{"name": "x", "endian": "little", "versions": [1],
+		"fields": [{"name": "a", "type": "uint64"}]}`))
+	assert.ErrorT(t, err)
+
+	_, err = Parse(strings.NewReader(`{"name": "x", "endian": "little", "versions": [1],
+		"fields": [{"name": "a", "type": "uint8", "units": "V"}]}`))
+	assert.ErrorT(t, err)
+
+	_, err = Parse(strings.NewReader(`{"name": "x", "endian": "little", "versions": [1],
+		"hardware": "hw", "sensors": {"bme280": {"bit": 1}},
+		"fields": [{"name": "hw", "type": "uint8"}, {"name": "t", "type": "float32", "sensor": "bme"}]}`))
+	assert.ErrorT(t, err)
+
+	_, err = Parse(strings.NewReader(`{"name": "x", "endian": "little", "versions": [1],
+		"sensors": {"bme280": {"bit": 1}},
+		"fields": [{"name": "t", "type": "float32", "sensor": "bme280"}]}`))
+	assert.ErrorT(t, err)
+}
@@ -0,0 +1,189 @@
+// Package semtech implements the network server side of the Semtech
+// UDP packet forwarder protocol, so the collector can take uplinks
+// directly from a gateway.
+//
+// The protocol is described in PROTOCOL.TXT in the
+// Lora-net/packet_forwarder repository.
+package semtech
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ProtocolVersion is the version of the forwarder protocol spoken by
+// the server. Version 1 forwarders are also accepted, as the packets
+// used here are the same.
+const ProtocolVersion = 2
+
+type PacketType uint8
+
+const (
+	PushData PacketType = iota
+	PushAck
+	PullData
+	PullResp
+	PullAck
+	TxAck
+)
+
+func (t PacketType) String() string {
+	switch t {
+	case PushData:
+		return "PUSH_DATA"
+	case PushAck:
+		return "PUSH_ACK"
+	case PullData:
+		return "PULL_DATA"
+	case PullResp:
+		return "PULL_RESP"
+	case PullAck:
+		return "PULL_ACK"
+	case TxAck:
+		return "TX_ACK"
+	default:
+		return fmt.Sprintf("unknown packet type %d", uint8(t))
+	}
+}
+
+// EUI is a gateway's 64-bit identifier.
+type EUI [8]byte
+
+func (eui EUI) String() string {
+	return strings.ToUpper(hex.EncodeToString(eui[:]))
+}
+
+var (
+	ErrShortPacket = errors.New("semtech: packet is too short")
+	ErrVersion     = errors.New("semtech: unsupported protocol version")
+)
+
+// Packet is a single forwarder datagram. Payload holds the JSON
+// object, if any, that follows the header.
+type Packet struct {
+	Version uint8
+	Token   uint16
+	Type    PacketType
+	Gateway EUI
+	Payload []byte
+}
+
+// hasEUI returns true if packets of type t carry the gateway EUI.
+func (t PacketType) hasEUI() bool {
+	return t == PushData || t == PullData || t == TxAck
+}
+
+// ParsePacket decodes a datagram received from a gateway.
+func ParsePacket(data []byte) (*Packet, error) {
+	if len(data) < 4 {
+		return nil, ErrShortPacket
+	}
+
+	p := &Packet{
+		Version: data[0],
+		Token:   binary.BigEndian.Uint16(data[1:3]),
+		Type:    PacketType(data[3]),
+	}
+
+	if p.Version != 1 && p.Version != ProtocolVersion {
+		return nil, ErrVersion
+	}
+
+	data = data[4:]
+	if p.Type.hasEUI() {
+		if len(data) < len(p.Gateway) {
+			return nil, ErrShortPacket
+		}
+		copy(p.Gateway[:], data)
+		data = data[len(p.Gateway):]
+	}
+
+	if len(data) > 0 {
+		p.Payload = data
+	}
+	return p, nil
+}
+
+// MarshalBinary encodes the packet for transmission.
+func (p *Packet) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 4, 12+len(p.Payload))
+	data[0] = p.Version
+	binary.BigEndian.PutUint16(data[1:3], p.Token)
+	data[3] = uint8(p.Type)
+
+	if p.Type.hasEUI() {
+		data = append(data, p.Gateway[:]...)
+	}
+
+	return append(data, p.Payload...), nil
+}
+
+// RXPK is a packet received by the gateway.
+type RXPK struct {
+	Time string  `json:"time,omitempty"`
+	Tmms uint64  `json:"tmms,omitempty"`
+	Tmst uint32  `json:"tmst"`
+	Freq float64 `json:"freq"`
+	Chan int     `json:"chan"`
+	RFCh int     `json:"rfch"`
+	Stat int     `json:"stat"`
+	Modu string  `json:"modu"`
+	Datr string  `json:"datr"`
+	Codr string  `json:"codr"`
+	RSSI int     `json:"rssi"`
+	LSNR float32 `json:"lsnr"`
+	Size int     `json:"size"`
+	Data string  `json:"data"`
+}
+
+// CRCOK is the stat value of a packet with a valid CRC.
+const CRCOK = 1
+
+// PHYPayload returns the decoded radio payload.
+func (rx *RXPK) PHYPayload() ([]byte, error) {
+	return base64.StdEncoding.DecodeString(rx.Data)
+}
+
+// Stat is the gateway status report that may accompany a PUSH_DATA.
+type Stat struct {
+	Time string  `json:"time"`
+	Lati float64 `json:"lati"`
+	Long float64 `json:"long"`
+	Alti int     `json:"alti"`
+	RXNb int     `json:"rxnb"`
+	RXOK int     `json:"rxok"`
+	RXFW int     `json:"rxfw"`
+	ACKR float32 `json:"ackr"`
+	DWNb int     `json:"dwnb"`
+	TXNb int     `json:"txnb"`
+}
+
+// PushDataPayload is the JSON object carried by a PUSH_DATA packet.
+type PushDataPayload struct {
+	RXPK []RXPK `json:"rxpk"`
+	Stat *Stat  `json:"stat"`
+}
+
+// TXPK is a packet for the gateway to transmit.
+type TXPK struct {
+	Imme bool    `json:"imme,omitempty"`
+	Tmst uint32  `json:"tmst,omitempty"`
+	Freq float64 `json:"freq"`
+	RFCh int     `json:"rfch"`
+	Powe int     `json:"powe"`
+	Modu string  `json:"modu"`
+	Datr string  `json:"datr"`
+	Codr string  `json:"codr"`
+	IPol bool    `json:"ipol"`
+	Size int     `json:"size"`
+	Data string  `json:"data"`
+}
+
+// PullRespPayload is the JSON object carried by a PULL_RESP packet.
+type PullRespPayload struct {
+	TXPK *TXPK `json:"txpk"`
+}
@@ -0,0 +1,194 @@
+package semtech
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"sync"
+)
+
+// maxPacketSize is larger than any datagram a forwarder will send; the
+// reference implementation caps them at 2408 bytes.
+const maxPacketSize = 65507
+
+// Handler receives the uplinks forwarded by a gateway. phy is the
+// LoRaWAN PHYPayload of the packet. HandleUplink is called from the
+// server's read loop, so it shouldn't block: no gateway is answered
+// until it returns.
+type Handler interface {
+	HandleUplink(gw EUI, rx *RXPK, phy []byte)
+}
+
+// HandlerFunc adapts a function to a Handler.
+type HandlerFunc func(gw EUI, rx *RXPK, phy []byte)
+
+func (f HandlerFunc) HandleUplink(gw EUI, rx *RXPK, phy []byte) {
+	f(gw, rx, phy)
+}
+
+// Server listens for packet forwarders. It acknowledges their
+// PUSH_DATA and PULL_DATA packets and passes each valid uplink to its
+// handler.
+type Server struct {
+	conn    *net.UDPConn
+	handler Handler
+
+	lock     sync.Mutex
+	gateways map[EUI]*net.UDPAddr
+}
+
+// ErrNoPull is returned when a downlink is sent to a gateway that
+// hasn't sent a PULL_DATA yet.
+var ErrNoPull = errors.New("semtech: gateway has not pulled")
+
+// Listen opens a UDP listener on addr.
+func Listen(addr string, handler Handler) (*Server, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		conn:     conn,
+		handler:  handler,
+		gateways: map[EUI]*net.UDPAddr{},
+	}, nil
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Close stops the server; Serve will return once it has.
+func (s *Server) Close() error {
+	return s.conn.Close()
+}
+
+// Serve reads packets until the server is closed.
+func (s *Server) Serve() error {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return err
+		}
+
+		p, err := ParsePacket(buf[:n])
+		if err != nil {
+			log.Printf("[ERROR] semtech: packet from %s: %s", addr, err)
+			continue
+		}
+
+		s.handlePacket(addr, p)
+	}
+}
+
+// Send queues a downlink on a gateway with a PULL_RESP.
+func (s *Server) Send(gw EUI, tx *TXPK) error {
+	s.lock.Lock()
+	addr, ok := s.gateways[gw]
+	s.lock.Unlock()
+	if !ok {
+		return ErrNoPull
+	}
+
+	payload, err := json.Marshal(&PullRespPayload{TXPK: tx})
+	if err != nil {
+		return err
+	}
+
+	var token [2]byte
+	if _, err = rand.Read(token[:]); err != nil {
+		return err
+	}
+
+	p := &Packet{
+		Version: ProtocolVersion,
+		Token:   binary.BigEndian.Uint16(token[:]),
+		Type:    PullResp,
+		Payload: payload,
+	}
+
+	data, err := p.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.conn.WriteToUDP(data, addr)
+	return err
+}
+
+func (s *Server) ack(addr *net.UDPAddr, p *Packet, ackType PacketType) {
+	ack := &Packet{
+		Version: p.Version,
+		Token:   p.Token,
+		Type:    ackType,
+	}
+
+	data, err := ack.MarshalBinary()
+	if err == nil {
+		_, err = s.conn.WriteToUDP(data, addr)
+	}
+
+	if err != nil {
+		log.Printf("[ERROR] semtech: sending %s to %s: %s", ackType, addr, err)
+	}
+}
+
+func (s *Server) handlePacket(addr *net.UDPAddr, p *Packet) {
+	switch p.Type {
+	case PushData:
+		s.ack(addr, p, PushAck)
+		s.pushData(p)
+	case PullData:
+		// Downlinks have to be sent to the address the gateway
+		// pulls from, which is not necessarily the one it pushes
+		// from.
+		s.lock.Lock()
+		s.gateways[p.Gateway] = addr
+		s.lock.Unlock()
+		s.ack(addr, p, PullAck)
+	case TxAck:
+		if len(p.Payload) > 0 {
+			log.Printf("semtech: TX_ACK from %s: %s", p.Gateway, p.Payload)
+		}
+	default:
+		log.Printf("semtech: ignoring %s from %s", p.Type, addr)
+	}
+}
+
+func (s *Server) pushData(p *Packet) {
+	if len(p.Payload) == 0 {
+		return
+	}
+
+	var push PushDataPayload
+	if err := json.Unmarshal(p.Payload, &push); err != nil {
+		log.Printf("[ERROR] semtech: PUSH_DATA from %s: %s", p.Gateway, err)
+		return
+	}
+
+	for i := range push.RXPK {
+		rx := &push.RXPK[i]
+		if rx.Stat != CRCOK {
+			continue
+		}
+
+		phy, err := rx.PHYPayload()
+		if err != nil {
+			log.Printf("[ERROR] semtech: rxpk from %s: %s", p.Gateway, err)
+			continue
+		}
+
+		s.handler.HandleUplink(p.Gateway, rx, phy)
+	}
+}
@@ -0,0 +1,114 @@
+package semtech
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kisom/goutils/assert"
+)
+
+var testGateway = EUI{0xB8, 0x27, 0xEB, 0xFF, 0xFE, 0x5E, 0x1A, 0x2B}
+
+type uplink struct {
+	gw  EUI
+	rx  RXPK
+	phy []byte
+}
+
+// fakeGateway sends a packet to the server and waits for the ack.
+func fakeGateway(t *testing.T, conn *net.UDPConn, p *Packet) *Packet {
+	data, err := p.MarshalBinary()
+	assert.NoErrorT(t, err)
+
+	_, err = conn.Write(data)
+	assert.NoErrorT(t, err)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, maxPacketSize)
+	n, err := conn.Read(buf)
+	assert.NoErrorT(t, err)
+
+	ack, err := ParsePacket(buf[:n])
+	assert.NoErrorT(t, err)
+	return ack
+}
+
+func TestServer(t *testing.T) {
+	uplinks := make(chan uplink, 2)
+	srv, err := Listen("127.0.0.1:0", HandlerFunc(func(gw EUI, rx *RXPK, phy []byte) {
+		uplinks <- uplink{gw: gw, rx: *rx, phy: phy}
+	}))
+	assert.NoErrorT(t, err)
+	defer srv.Close()
+	go srv.Serve()
+
+	conn, err := net.DialUDP("udp", nil, srv.Addr().(*net.UDPAddr))
+	assert.NoErrorT(t, err)
+	defer conn.Close()
+
+	ack := fakeGateway(t, conn, &Packet{
+		Version: ProtocolVersion,
+		Token:   0x1234,
+		Type:    PullData,
+		Gateway: testGateway,
+	})
+	assert.BoolT(t, ack.Type == PullAck, "expected PULL_ACK")
+	assert.BoolT(t, ack.Token == 0x1234, "token")
+
+	ack = fakeGateway(t, conn, &Packet{
+		Version: ProtocolVersion,
+		Token:   0x4321,
+		Type:    PushData,
+		Gateway: testGateway,
+		Payload: []byte(`{"rxpk":[
+{"tmst":3512348611,"chan":2,"rfch":0,"freq":904.300000,"stat":1,"modu":"LORA","datr":"SF7BW125","codr":"4/5","rssi":-35,"lsnr":5.1,"size":4,"data":"AQIDBA=="},
+{"tmst":3512348612,"chan":2,"rfch":0,"freq":904.300000,"stat":-1,"modu":"LORA","datr":"SF7BW125","codr":"4/5","rssi":-35,"lsnr":5.1,"size":4,"data":"BQYHCA=="}
+],"stat":{"time":"2019-10-29 11:30:05 GMT","rxnb":2,"rxok":1,"rxfw":1,"ackr":100.0,"dwnb":0,"txnb":0}}`),
+	})
+	assert.BoolT(t, ack.Type == PushAck, "expected PUSH_ACK")
+	assert.BoolT(t, ack.Token == 0x4321, "token")
+
+	select {
+	case up := <-uplinks:
+		assert.BoolT(t, up.gw == testGateway, "gateway EUI")
+		assert.BoolT(t, up.rx.Tmst == 3512348611, "tmst")
+		assert.BoolT(t, bytes.Equal(up.phy, []byte{1, 2, 3, 4}), "PHYPayload")
+	case <-time.After(time.Second):
+		t.Fatal("uplink was not handed off")
+	}
+
+	select {
+	case <-uplinks:
+		t.Fatal("uplink with a bad CRC was handed off")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	err = srv.Send(testGateway, &TXPK{Tmst: 3517348611, Freq: 924.5, Datr: "SF7BW500", Data: "AQIDBA=="})
+	assert.NoErrorT(t, err)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, maxPacketSize)
+	n, err := conn.Read(buf)
+	assert.NoErrorT(t, err)
+
+	resp, err := ParsePacket(buf[:n])
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, resp.Type == PullResp, "expected PULL_RESP")
+	assert.BoolT(t, bytes.Contains(resp.Payload, []byte(`"tmst":3517348611`)), "txpk")
+
+	err = srv.Send(EUI{}, &TXPK{})
+	assert.ErrorEqT(t, ErrNoPull, err)
+}
+
+func TestParsePacket(t *testing.T) {
+	_, err := ParsePacket([]byte{2, 0})
+	assert.ErrorEqT(t, ErrShortPacket, err)
+
+	_, err = ParsePacket([]byte{3, 0, 0, 2})
+	assert.ErrorEqT(t, ErrVersion, err)
+
+	_, err = ParsePacket([]byte{2, 0, 0, byte(PullData), 1, 2, 3})
+	assert.ErrorEqT(t, ErrShortPacket, err)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/kisom/redenv/collector/spool"
+	"github.com/kisom/redenv/collector/storage"
+	"github.com/kisom/redenv/collector/ttn"
+)
+
+// replayInterval is how often the spool is retried while the store is
+// failing.
+const replayInterval = 30 * time.Second
+
+// errSpooled is returned by ingest when an uplink was spooled rather
+// than stored.
+var errSpooled = errors.New("collector: uplink spooled")
+
+var uplinkSpool *spool.Spool
+
+// spoolUplink appends an uplink to the spool. Uplinks are spooled in
+// the v2 form, which every source converts to.
+func spoolUplink(u *ttn.Uplink) error {
+	rec, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+
+	if err = uplinkSpool.Append(rec); err != nil {
+		return err
+	}
+
+	log.Printf("uplink %d from %s spooled (%d waiting)", u.Counter, u.DevID,
+		uplinkSpool.Depth())
+	return errSpooled
+}
+
+// replayUplink stores a spooled uplink, without a reading if its
+// payload can't be decoded. Records that aren't uplinks are logged and
+// dropped; they would never be stored. Other errors count against the
+// record, unless the database is unavailable.
+func replayUplink(rec []byte) error {
+	u := &ttn.Uplink{}
+	if err := json.Unmarshal(rec, u); err != nil {
+		log.Printf("[ERROR] dropping unreadable spooled uplink: %s", err)
+		return nil
+	}
+
+	err := storeUplink(u)
+	switch {
+	case err == nil, err == storage.ErrDuplicate, err == errUndecoded:
+		return nil
+	case storage.Unavailable(err):
+		return spool.Defer(err)
+	}
+
+	log.Printf("[ERROR] storing spooled uplink %d from %s: %s", u.Counter, u.DevID, err)
+	return err
+}
+
+// replaySpool drains the spool into the store, in order, every
+// replayInterval.
+func replaySpool() {
+	for range time.Tick(replayInterval) {
+		if uplinkSpool.Depth() == 0 {
+			continue
+		}
+
+		dead := uplinkSpool.Dead()
+		n, err := uplinkSpool.Drain(replayUplink)
+		if n > 0 {
+			log.Printf("stored %d spooled uplinks", n)
+		}
+
+		if moved := uplinkSpool.Dead() - dead; moved > 0 {
+			log.Printf("[ERROR] moved %d spooled uplinks that failed %d times to the dead-letter file",
+				moved, spool.MaxAttempts)
+		}
+
+		if err != nil {
+			log.Printf("[ERROR] replaying spool: %s (%d waiting)", err, uplinkSpool.Depth())
+		}
+	}
+}
@@ -0,0 +1,423 @@
+// Package spool implements a write-ahead spool for uplinks that
+// couldn't be stored. Records are appended to a segment file and
+// synced before Append returns; Drain hands them back in order and
+// remembers how far it got in an offset file.
+//
+// Records are delivered at least once: if the collector stops after a
+// record was handled but before the offset was saved, it is handed
+// back again when the spool is reopened. A record that keeps failing
+// is moved to a dead-letter file, in the same format as the segment,
+// so that it doesn't hold up the records behind it.
+package spool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	segmentFile = "segment"
+	offsetFile  = "offset"
+	deadFile    = "dead"
+
+	// Each record is preceded by its length and CRC-32, both
+	// big-endian uint32s.
+	headerSize = 8
+
+	// MaxRecord is the size of the largest record that can be
+	// spooled.
+	MaxRecord = 1 << 20
+
+	// MaxAttempts is how many times Drain hands a record to a
+	// handler that fails it before moving it to the dead-letter
+	// file.
+	MaxAttempts = 5
+)
+
+var (
+	ErrTooLarge = errors.New("spool: record is too large")
+	ErrClosed   = errors.New("spool: spool is closed")
+)
+
+// A Spool is an append-only queue of records kept in a directory.
+type Spool struct {
+	mu     sync.Mutex
+	dir    string
+	f      *os.File
+	offset int64 // the start of the next record to drain
+	size   int64 // the end of the last complete record
+	depth  int
+
+	// attempts counts the failures of the record at offset. It
+	// isn't kept across restarts.
+	attempts int
+	dead     int
+}
+
+// Open opens the spool in dir, creating it if needed. A record that
+// was only partly written when the collector stopped is discarded.
+func Open(dir string) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, segmentFile), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Spool{dir: dir, f: f}
+	if err = s.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the saved offset and counts the records after it,
+// truncating the segment after the last complete record.
+func (s *Spool) load() error {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, offsetFile))
+	if err == nil {
+		s.offset, err = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return fmt.Errorf("spool: bad offset file: %s", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	fi, err := s.f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// The segment is truncated before the offset is reset once
+	// it has been drained; if the collector stopped in between,
+	// the offset is past the end.
+	if s.offset > fi.Size() {
+		s.offset = 0
+	}
+
+	s.size = s.offset
+	for {
+		rec, err := s.read(s.size)
+		if err != nil {
+			break
+		}
+		s.size += int64(headerSize + len(rec))
+		s.depth++
+	}
+
+	if s.size < fi.Size() {
+		if err = s.f.Truncate(s.size); err != nil {
+			return err
+		}
+	}
+
+	if _, err = s.f.Seek(s.size, io.SeekStart); err != nil {
+		return err
+	}
+
+	dead, err := os.Open(filepath.Join(s.dir, deadFile))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer dead.Close()
+
+	for off := int64(0); ; s.dead++ {
+		rec, err := readRecord(dead, off)
+		if err != nil {
+			break
+		}
+		off += int64(headerSize + len(rec))
+	}
+	return nil
+}
+
+// read returns the record at off. It returns an error if there is no
+// complete record there.
+func (s *Spool) read(off int64) ([]byte, error) {
+	return readRecord(s.f, off)
+}
+
+// readRecord returns the record at off in f.
+func readRecord(f *os.File, off int64) ([]byte, error) {
+	var header [headerSize]byte
+	if _, err := f.ReadAt(header[:], off); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[:4])
+	if length > MaxRecord {
+		return nil, ErrTooLarge
+	}
+
+	rec := make([]byte, length)
+	if _, err := f.ReadAt(rec, off+headerSize); err != nil {
+		return nil, err
+	}
+
+	if crc32.ChecksumIEEE(rec) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, errors.New("spool: record is corrupt")
+	}
+	return rec, nil
+}
+
+// frame prepends a record's header.
+func frame(rec []byte) []byte {
+	buf := make([]byte, headerSize+len(rec))
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(rec)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(rec))
+	copy(buf[headerSize:], rec)
+	return buf
+}
+
+// syncSegment syncs the segment; tests replace it to make syncs fail.
+var syncSegment = (*os.File).Sync
+
+// rewind drops anything written after the last complete record.
+func (s *Spool) rewind() {
+	s.f.Truncate(s.size)
+	s.f.Seek(s.size, io.SeekStart)
+}
+
+// Append adds a record to the end of the spool, returning once it is
+// on disk.
+func (s *Spool) Append(rec []byte) error {
+	if len(rec) > MaxRecord {
+		return ErrTooLarge
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return ErrClosed
+	}
+
+	// If the record can't be written and synced, the segment is
+	// left as it was: the caller is told the append failed, and
+	// the next record mustn't follow one that isn't counted.
+	buf := frame(rec)
+	if _, err := s.f.Write(buf); err != nil {
+		s.rewind()
+		return err
+	}
+
+	if err := syncSegment(s.f); err != nil {
+		s.rewind()
+		return err
+	}
+
+	s.size += int64(len(buf))
+	s.depth++
+	return nil
+}
+
+// Depth returns the number of records waiting to be drained.
+func (s *Spool) Depth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.depth
+}
+
+// Dead returns the number of records in the dead-letter file.
+func (s *Spool) Dead() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dead
+}
+
+// saveOffset records how far the spool has been drained. The file is
+// replaced, so that it is never seen half-written.
+func (s *Spool) saveOffset() error {
+	path := filepath.Join(s.dir, offsetFile)
+	tmp, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(tmp, "%d\n", s.offset)
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// next returns the next record to drain and where the one after it
+// starts, or a nil record if the spool is empty.
+func (s *Spool) next() ([]byte, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return nil, 0, ErrClosed
+	}
+
+	if s.offset >= s.size {
+		return nil, 0, nil
+	}
+
+	rec, err := s.read(s.offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rec, s.offset + int64(headerSize+len(rec)), nil
+}
+
+// advance moves past a drained record. Once everything has been
+// drained, the segment is emptied.
+func (s *Spool) advance(next int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return ErrClosed
+	}
+
+	s.offset = next
+	s.depth--
+	s.attempts = 0
+	if s.offset == s.size {
+		if err := s.f.Truncate(0); err != nil {
+			return err
+		}
+
+		if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		if err := s.f.Sync(); err != nil {
+			return err
+		}
+		s.offset, s.size = 0, 0
+	}
+
+	return s.saveOffset()
+}
+
+// failed counts a failed attempt at the record being drained, and
+// reports whether it has failed MaxAttempts times.
+func (s *Spool) failed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	return s.attempts >= MaxAttempts
+}
+
+// bury moves the record being drained to the dead-letter file.
+func (s *Spool) bury(rec []byte, next int64) error {
+	f, err := os.OpenFile(filepath.Join(s.dir, deadFile),
+		os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(frame(rec))
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.dead++
+	s.mu.Unlock()
+	return s.advance(next)
+}
+
+// deferred is a handler error that isn't the record's fault.
+type deferred struct {
+	err error
+}
+
+func (d *deferred) Error() string { return d.err.Error() }
+func (d *deferred) Unwrap() error { return d.err }
+
+// Defer wraps an error returned by a Drain handler when the record
+// isn't at fault, e.g. because the database is down. The record isn't
+// counted as having failed.
+func Defer(err error) error {
+	return &deferred{err: err}
+}
+
+// Drain passes each record to handle, oldest first. A record is
+// removed from the spool once handle returns nil; if it returns an
+// error, Drain stops and returns it, and the record is handed back on
+// the next call. Once a record has failed MaxAttempts times, it is
+// moved to the dead-letter file and Drain carries on with the next
+// one; errors wrapped with Defer don't count. Drain returns the number
+// of records removed, not counting those moved.
+//
+// Records may be appended while the spool is being drained, but only
+// one Drain should run at a time.
+func (s *Spool) Drain(handle func(rec []byte) error) (int, error) {
+	var n int
+	for {
+		rec, next, err := s.next()
+		if err != nil || rec == nil {
+			return n, err
+		}
+
+		if err = handle(rec); err != nil {
+			var d *deferred
+			if errors.As(err, &d) {
+				return n, d.err
+			}
+
+			if !s.failed() {
+				return n, err
+			}
+
+			if err = s.bury(rec, next); err != nil {
+				return n, err
+			}
+			continue
+		}
+
+		if err = s.advance(next); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return ErrClosed
+	}
+
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
@@ -0,0 +1,182 @@
+package spool
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kisom/goutils/assert"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "spool")
+	assert.NoErrorT(t, err)
+	return dir
+}
+
+func drainAll(t *testing.T, s *Spool) []string {
+	var recs []string
+	_, err := s.Drain(func(rec []byte) error {
+		recs = append(recs, string(rec))
+		return nil
+	})
+	assert.NoErrorT(t, err)
+	return recs
+}
+
+func TestSpool(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir)
+	assert.NoErrorT(t, err)
+	for i := 0; i < 3; i++ {
+		assert.NoErrorT(t, s.Append([]byte(fmt.Sprintf("uplink %d", i))))
+	}
+	assert.BoolT(t, s.Depth() == 3, "depth")
+
+	// A failure stops the drain and leaves the record spooled.
+	errDown := errors.New("database is down")
+	n, err := s.Drain(func(rec []byte) error {
+		if string(rec) == "uplink 1" {
+			return errDown
+		}
+		return nil
+	})
+	assert.ErrorEqT(t, err, errDown)
+	assert.BoolT(t, n == 1 && s.Depth() == 2, "partly drained")
+	assert.NoErrorT(t, s.Close())
+
+	// The spool picks up where it left off.
+	s, err = Open(dir)
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, s.Depth() == 2, "depth after reopening")
+	assert.NoErrorT(t, s.Append([]byte("uplink 3")))
+
+	recs := drainAll(t, s)
+	assert.BoolT(t, fmt.Sprint(recs) == "[uplink 1 uplink 2 uplink 3]", fmt.Sprint(recs))
+	assert.BoolT(t, s.Depth() == 0, "drained")
+
+	fi, err := os.Stat(filepath.Join(dir, segmentFile))
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, fi.Size() == 0, "segment emptied")
+
+	n, err = s.Drain(func(rec []byte) error { return errDown })
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, n == 0, "nothing to drain")
+	assert.NoErrorT(t, s.Close())
+	assert.ErrorEqT(t, s.Append([]byte("late")), ErrClosed)
+}
+
+func TestTornRecord(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir)
+	assert.NoErrorT(t, err)
+	assert.NoErrorT(t, s.Append([]byte("complete")))
+	assert.NoErrorT(t, s.Close())
+
+	// The collector stopped halfway through writing a record.
+	f, err := os.OpenFile(filepath.Join(dir, segmentFile), os.O_WRONLY|os.O_APPEND, 0600)
+	assert.NoErrorT(t, err)
+	_, err = f.Write([]byte{0, 0, 0, 20, 1, 2, 3, 4, 'p', 'a', 'r'})
+	assert.NoErrorT(t, err)
+	assert.NoErrorT(t, f.Close())
+
+	s, err = Open(dir)
+	assert.NoErrorT(t, err)
+	defer s.Close()
+	assert.BoolT(t, s.Depth() == 1, "partial record dropped")
+
+	assert.NoErrorT(t, s.Append([]byte("after")))
+	recs := drainAll(t, s)
+	assert.BoolT(t, fmt.Sprint(recs) == "[complete after]", fmt.Sprint(recs))
+
+	assert.ErrorEqT(t, s.Append(make([]byte, MaxRecord+1)), ErrTooLarge)
+}
+
+func TestSyncFailure(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir)
+	assert.NoErrorT(t, err)
+	defer s.Close()
+	assert.NoErrorT(t, s.Append([]byte("before")))
+
+	// The record is written, but it can't be synced.
+	errSync := errors.New("sync failed")
+	syncSegment = func(*os.File) error { return errSync }
+	err = s.Append([]byte("unsynced"))
+	syncSegment = (*os.File).Sync
+	assert.ErrorEqT(t, err, errSync)
+	assert.BoolT(t, s.Depth() == 1, "failed append not counted")
+
+	assert.NoErrorT(t, s.Append([]byte("after")))
+	recs := drainAll(t, s)
+	assert.BoolT(t, fmt.Sprint(recs) == "[before after]", fmt.Sprint(recs))
+
+	// Draining empties the segment without losing anything.
+	assert.NoErrorT(t, s.Append([]byte("last")))
+	recs = drainAll(t, s)
+	assert.BoolT(t, fmt.Sprint(recs) == "[last]", fmt.Sprint(recs))
+}
+
+func TestDeadLetter(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir)
+	assert.NoErrorT(t, err)
+	assert.NoErrorT(t, s.Append([]byte("poison")))
+	assert.NoErrorT(t, s.Append([]byte("good")))
+
+	errRefused := errors.New("constraint violated")
+	errDown := errors.New("database is down")
+	var stored []string
+	handle := func(down bool) func([]byte) error {
+		return func(rec []byte) error {
+			if down {
+				return Defer(errDown)
+			}
+
+			if string(rec) == "poison" {
+				return errRefused
+			}
+			stored = append(stored, string(rec))
+			return nil
+		}
+	}
+
+	for i := 1; i < MaxAttempts; i++ {
+		_, err = s.Drain(handle(false))
+		assert.ErrorEqT(t, err, errRefused)
+
+		// The database being down isn't the record's fault.
+		_, err = s.Drain(handle(true))
+		assert.ErrorEqT(t, err, errDown)
+		assert.BoolT(t, s.Depth() == 2 && s.Dead() == 0, "record retried")
+	}
+
+	n, err := s.Drain(handle(false))
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, n == 1 && fmt.Sprint(stored) == "[good]", fmt.Sprint(stored))
+	assert.BoolT(t, s.Depth() == 0 && s.Dead() == 1, "record moved")
+	assert.NoErrorT(t, s.Close())
+
+	s, err = Open(dir)
+	assert.NoErrorT(t, err)
+	defer s.Close()
+	assert.BoolT(t, s.Dead() == 1, "dead records counted on reopening")
+
+	f, err := os.Open(filepath.Join(dir, deadFile))
+	assert.NoErrorT(t, err)
+	defer f.Close()
+	rec, err := readRecord(f, 0)
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, string(rec) == "poison", "dead-letter record")
+}
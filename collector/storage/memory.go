@@ -0,0 +1,443 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kisom/redenv/collector/lorawan"
+	"github.com/kisom/redenv/collector/reading"
+	"github.com/kisom/redenv/collector/ttn"
+)
+
+// memUplink is an uplink held by a Memory store.
+type memUplink struct {
+	id         string
+	receivedAt int64
+	uplink     ttn.Uplink
+}
+
+// Memory is a Store that keeps everything in memory, for tests. Like
+// the SQL stores, it keeps times to the second.
+type Memory struct {
+	mu           sync.Mutex
+	uplinks      []memUplink
+	readings     []*reading.Reading
+	derived      map[string]Derived // by reading ID
+	calibrations []reading.Calibration
+	duplicates   map[string]int64
+	sensors      map[[2]string]time.Time
+	sessions     map[string]*lorawan.Session
+	nonces       map[lorawan.EUI64]map[uint16]bool
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		derived:    map[string]Derived{},
+		duplicates: map[string]int64{},
+		sensors:    map[[2]string]time.Time{},
+		sessions:   map[string]*lorawan.Session{},
+		nonces:     map[lorawan.EUI64]map[uint16]bool{},
+	}
+}
+
+// AddCalibration adds a calibration profile; the SQL stores have them
+// added to the calibrations table by hand.
+func (m *Memory) AddCalibration(c reading.Calibration) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calibrations = append(m.calibrations, c)
+	return nil
+}
+
+func (m *Memory) Close() error { return nil }
+
+// copyReading returns a copy of r that shares nothing with it, as the
+// SQL stores would give back.
+func copyReading(r *reading.Reading) *reading.Reading {
+	c := *r
+	c.ReceivedAt = time.Unix(r.ReceivedAt.Unix(), 0)
+	c.When = time.Unix(r.When.Unix(), 0)
+	c.OriginalWhen = time.Time{}
+	if r.TimeCorrected {
+		c.OriginalWhen = time.Unix(r.OriginalWhen.Unix(), 0)
+	}
+	c.CCS811Error = nil
+
+	if r.Raw != nil {
+		raw := *r.Raw
+		c.Raw = &raw
+	}
+
+	if r.Elevation != nil {
+		elevation := *r.Elevation
+		c.Elevation = &elevation
+	}
+
+	c.Measurements = nil
+	if len(r.Measurements) > 0 {
+		c.Measurements = append([]reading.Measurement(nil), r.Measurements...)
+	}
+	return &c
+}
+
+func (m *Memory) insertUplink(u *ttn.Uplink, receivedAt time.Time) (string, error) {
+	for _, stored := range m.uplinks {
+		if stored.uplink.DevID == u.DevID && stored.uplink.Counter == u.Counter &&
+			stored.uplink.PayloadRaw == u.PayloadRaw {
+			m.duplicates[u.DevID]++
+			return stored.id, ErrDuplicate
+		}
+	}
+
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+
+	stored := *u
+	stored.Metadata.Gateways = append([]ttn.Gateway(nil), u.Metadata.Gateways...)
+	sortGateways(stored.Metadata.Gateways)
+
+	m.uplinks = append(m.uplinks, memUplink{
+		id:         id,
+		receivedAt: receivedAt.Unix(),
+		uplink:     stored,
+	})
+	return id, nil
+}
+
+// sortGateways puts the strongest reception first, as the SQL stores
+// return them.
+func sortGateways(gateways []ttn.Gateway) {
+	sort.SliceStable(gateways, func(i, j int) bool {
+		return gateways[i].RSSI > gateways[j].RSSI
+	})
+}
+
+func (m *Memory) insertReading(r *reading.Reading) error {
+	if r.ID == "" {
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		r.ID = id
+	}
+
+	m.readings = append(m.readings, copyReading(r))
+	m.derived[r.ID] = Derive(r)
+	return nil
+}
+
+func (m *Memory) InsertUplink(u *ttn.Uplink, receivedAt time.Time) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.insertUplink(u, receivedAt)
+}
+
+func (m *Memory) AddReceptions(u *ttn.Uplink, receivedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.uplinks {
+		stored := &m.uplinks[i].uplink
+		if stored.DevID != u.DevID || stored.Counter != u.Counter ||
+			stored.PayloadRaw != u.PayloadRaw {
+			continue
+		}
+
+	next:
+		for _, gw := range u.Metadata.Gateways {
+			for _, seen := range stored.Metadata.Gateways {
+				if seen.GatewayID == gw.GatewayID {
+					continue next
+				}
+			}
+			stored.Metadata.Gateways = append(stored.Metadata.Gateways, gw)
+		}
+
+		sortGateways(stored.Metadata.Gateways)
+		return nil
+	}
+
+	return ErrNotFound
+}
+
+func (m *Memory) InsertReading(r *reading.Reading) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.insertReading(r)
+}
+
+func (m *Memory) StoreUplink(r *reading.Reading, u *ttn.Uplink) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, err := m.insertUplink(u, r.ReceivedAt)
+	if err == ErrDuplicate {
+		r.Uplink = id
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	r.Uplink = id
+	if err = m.insertReading(r); err != nil {
+		m.uplinks = m.uplinks[:len(m.uplinks)-1]
+		return err
+	}
+	return nil
+}
+
+func (m *Memory) Duplicates() (map[string]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	duplicates := map[string]int64{}
+	for device, count := range m.duplicates {
+		duplicates[device] = count
+	}
+	return duplicates, nil
+}
+
+// storedUplink returns a copy of a stored uplink.
+func storedUplink(mu memUplink) *StoredUplink {
+	u := mu.uplink
+	u.Metadata.Time = uplinkTime(u.DevID, mu.receivedAt)
+	u.Metadata.Gateways = append([]ttn.Gateway(nil), mu.uplink.Metadata.Gateways...)
+	return &StoredUplink{
+		ID:         mu.id,
+		ReceivedAt: time.Unix(mu.receivedAt, 0),
+		Uplink:     &u,
+	}
+}
+
+func (m *Memory) LatestUplink() (*ttn.Uplink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var latest *memUplink
+	for i := range m.uplinks {
+		if latest == nil || m.uplinks[i].receivedAt >= latest.receivedAt {
+			latest = &m.uplinks[i]
+		}
+	}
+
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+
+	return storedUplink(*latest).Uplink, nil
+}
+
+func (m *Memory) Uplinks(device string, from, to time.Time) ([]*StoredUplink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var uplinks []*StoredUplink
+	for _, mu := range m.uplinks {
+		if mu.uplink.DevID != device || mu.receivedAt < from.Unix() || mu.receivedAt >= to.Unix() {
+			continue
+		}
+		uplinks = append(uplinks, storedUplink(mu))
+	}
+
+	sort.SliceStable(uplinks, func(i, j int) bool {
+		a, b := uplinks[i], uplinks[j]
+		if !a.ReceivedAt.Equal(b.ReceivedAt) {
+			return a.ReceivedAt.Before(b.ReceivedAt)
+		}
+		return a.Uplink.Counter < b.Uplink.Counter
+	})
+	return uplinks, nil
+}
+
+func (m *Memory) ReadingFor(uplink string) (*StoredReading, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.readings {
+		if r.Uplink == uplink {
+			return &StoredReading{Reading: copyReading(r), Derived: m.derived[r.ID]}, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *Memory) ReplaceReadings(readings []*reading.Reading, removed []string, sensors []Sensor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	replaced := map[string]bool{}
+	for _, uplink := range removed {
+		replaced[uplink] = true
+	}
+
+	for _, r := range readings {
+		replaced[r.Uplink] = true
+	}
+
+	kept := m.readings[:0:0]
+	for _, r := range m.readings {
+		if !replaced[r.Uplink] {
+			kept = append(kept, r)
+			continue
+		}
+		delete(m.derived, r.ID)
+	}
+
+	for _, r := range readings {
+		if r.ID == "" {
+			id, err := newID()
+			if err != nil {
+				return err
+			}
+			r.ID = id
+		}
+		kept = append(kept, copyReading(r))
+		m.derived[r.ID] = Derive(r)
+	}
+
+	m.readings = kept
+	for _, sensor := range sensors {
+		key := [2]string{sensor.Device, sensor.Sensor}
+		if _, ok := m.sensors[key]; !ok {
+			m.sensors[key] = time.Unix(sensor.FirstSeen.Unix(), 0)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Latest(device string) (*reading.Reading, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var latest *reading.Reading
+	for _, r := range m.readings {
+		if r.Device != device {
+			continue
+		}
+
+		if latest == nil || !r.When.Before(latest.When) {
+			latest = r
+		}
+	}
+
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+	return copyReading(latest), nil
+}
+
+func (m *Memory) Readings(device string, from, to time.Time) ([]*reading.Reading, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	from, to = time.Unix(from.Unix(), 0), time.Unix(to.Unix(), 0)
+
+	var readings []*reading.Reading
+	for _, r := range m.readings {
+		if r.Device != device || r.When.Before(from) || !r.When.Before(to) {
+			continue
+		}
+		readings = append(readings, copyReading(r))
+	}
+
+	sort.SliceStable(readings, func(i, j int) bool {
+		return readings[i].When.Before(readings[j].When)
+	})
+	return readings, nil
+}
+
+func (m *Memory) Calibrations(device string) ([]reading.Calibration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var cals []reading.Calibration
+	for _, c := range m.calibrations {
+		if c.Device == device {
+			cals = append(cals, c)
+		}
+	}
+	return cals, nil
+}
+
+func (m *Memory) SensorFirstSeen(device, sensor string, when time.Time) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := [2]string{device, sensor}
+	if firstSeen, ok := m.sensors[key]; ok {
+		return firstSeen, nil
+	}
+
+	m.sensors[key] = time.Unix(when.Unix(), 0)
+	return m.sensors[key], nil
+}
+
+func (m *Memory) SensorSeen(device, sensor string) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	firstSeen, ok := m.sensors[[2]string{device, sensor}]
+	if !ok {
+		return time.Time{}, ErrNotFound
+	}
+	return firstSeen, nil
+}
+
+func (m *Memory) Session(addr lorawan.DevAddr) (*lorawan.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.sessions {
+		if s.DevAddr == addr {
+			sess := *s
+			return &sess, nil
+		}
+	}
+	return nil, lorawan.ErrUnknownDevice
+}
+
+func (m *Memory) UpdateSession(sess *lorawan.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.sessions {
+		if s.DevAddr == sess.DevAddr {
+			s.FCntUp = sess.FCntUp
+			return nil
+		}
+	}
+	return lorawan.ErrUnknownDevice
+}
+
+func (m *Memory) UseDevNonce(devEUI lorawan.EUI64, nonce uint16) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.nonces[devEUI] == nil {
+		m.nonces[devEUI] = map[uint16]bool{}
+	}
+
+	if m.nonces[devEUI][nonce] {
+		return lorawan.ErrDevNonce
+	}
+	m.nonces[devEUI][nonce] = true
+	return nil
+}
+
+func (m *Memory) SaveSession(sess *lorawan.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := *sess
+	m.sessions[s.DevEUI] = &s
+	return nil
+}
+
+var _ Store = (*Memory)(nil)
@@ -0,0 +1,310 @@
+package storage
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The migrations for each dialect are in migrations/<dialect>. A
+// migration to version V is schema.V.sql, and schema.V.down.sql undoes
+// it; V is the time the migration was written, as YYYYMMDDHHMM.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// A Migration takes the schema from the previous version to Version.
+type Migration struct {
+	Version int64
+	Up      string
+	Down    string
+}
+
+// Migrations returns the dialect's migrations, oldest first.
+func Migrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("storage: no migrations for %s", dialect)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+		parts := strings.Split(name, ".")
+		if len(parts) < 3 || parts[0] != "schema" || parts[len(parts)-1] != "sql" {
+			return nil, fmt.Errorf("storage: unexpected migration file %s", name)
+		}
+
+		version, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("storage: bad migration version in %s", name)
+		}
+
+		data, err := migrationFiles.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version}
+			byVersion[version] = m
+		}
+
+		switch len(parts) {
+		case 3:
+			m.Up = string(data)
+		case 4:
+			if parts[2] != "down" {
+				return nil, fmt.Errorf("storage: unexpected migration file %s", name)
+			}
+			m.Down = string(data)
+		default:
+			return nil, fmt.Errorf("storage: unexpected migration file %s", name)
+		}
+	}
+
+	var migrations []Migration
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("storage: migration %d needs both up and down files",
+				m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+const (
+	createMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version			BIGINT PRIMARY KEY,
+	applied_at		BIGINT NOT NULL
+)`
+	selectMigrations = `SELECT version, applied_at FROM schema_migrations`
+	insertMigration  = `INSERT INTO schema_migrations (version, applied_at) VALUES ($1, $2)`
+	deleteMigration  = `DELETE FROM schema_migrations WHERE version = $1`
+)
+
+// MigrationStatus is a migration and whether it has been applied.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+
+	// Unknown is set for versions recorded in the database that
+	// this collector has no migration for.
+	Unknown bool
+}
+
+// applied returns the versions recorded in the database and when they
+// were applied.
+func (s *SQLStore) applied() (map[int64]time.Time, error) {
+	if _, err := s.db.Exec(createMigrations); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(selectMigrations)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var version, at int64
+		if err = rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = time.Unix(at, 0)
+	}
+
+	return applied, rows.Err()
+}
+
+// Status returns every migration, in order, and whether it has been
+// applied.
+func (s *SQLStore) Status() ([]MigrationStatus, error) {
+	migrations, err := Migrations(s.dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := s.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var status []MigrationStatus
+	for _, m := range migrations {
+		at, ok := applied[m.Version]
+		status = append(status, MigrationStatus{Migration: m, Applied: ok, AppliedAt: at})
+		delete(applied, m.Version)
+	}
+
+	for version, at := range applied {
+		status = append(status, MigrationStatus{
+			Migration: Migration{Version: version},
+			Applied:   true,
+			AppliedAt: at,
+			Unknown:   true,
+		})
+	}
+
+	sort.SliceStable(status, func(i, j int) bool {
+		return status[i].Version < status[j].Version
+	})
+	return status, nil
+}
+
+// known returns the status of the migrations, or an error if the
+// database has versions this collector doesn't know about; a newer
+// collector has been run against it.
+func (s *SQLStore) known() ([]MigrationStatus, error) {
+	status, err := s.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range status {
+		if m.Unknown {
+			return nil, fmt.Errorf("storage: database has schema version %d, which this collector doesn't know",
+				m.Version)
+		}
+	}
+	return status, nil
+}
+
+// CheckSchema returns an error unless every migration this collector
+// knows about, and no others, has been applied.
+func (s *SQLStore) CheckSchema() error {
+	status, err := s.known()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range status {
+		if !m.Applied {
+			return fmt.Errorf("storage: database schema is missing version %d; run collector migrate up",
+				m.Version)
+		}
+	}
+	return nil
+}
+
+// unwrap strips the BEGIN and COMMIT from a script that was written to
+// be run by hand with psql; migrations run in a transaction of their
+// own.
+func unwrap(script string) string {
+	trimmed := strings.TrimSpace(script)
+	if !strings.HasPrefix(trimmed, "BEGIN;") || !strings.HasSuffix(trimmed, "COMMIT;") {
+		return script
+	}
+	return trimmed[len("BEGIN;") : len(trimmed)-len("COMMIT;")]
+}
+
+// migrate runs a migration's SQL and records the change in the same
+// transaction.
+func (s *SQLStore) migrate(m Migration, up bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	script, record, args := m.Up, insertMigration, []interface{}{m.Version, time.Now().Unix()}
+	if !up {
+		script, record, args = m.Down, deleteMigration, []interface{}{m.Version}
+	}
+
+	if _, err = tx.Exec(unwrap(script)); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("storage: migration %d: %s", m.Version, err)
+	}
+
+	if _, err = tx.Exec(record, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MigrateUp applies the pending migrations up to and including target,
+// or all of them if target is 0. It returns the versions applied.
+func (s *SQLStore) MigrateUp(target int64) ([]int64, error) {
+	status, err := s.known()
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []int64
+	for _, m := range status {
+		if m.Applied || (target != 0 && m.Version > target) {
+			continue
+		}
+
+		if err = s.migrate(m.Migration, true); err != nil {
+			return versions, err
+		}
+		versions = append(versions, m.Version)
+	}
+
+	return versions, nil
+}
+
+// MigrateDown undoes the migrations after target, newest first. It
+// returns the versions undone.
+func (s *SQLStore) MigrateDown(target int64) ([]int64, error) {
+	status, err := s.known()
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []int64
+	for i := len(status) - 1; i >= 0; i-- {
+		m := status[i]
+		if !m.Applied || m.Version <= target {
+			continue
+		}
+
+		if err = s.migrate(m.Migration, false); err != nil {
+			return versions, err
+		}
+		versions = append(versions, m.Version)
+	}
+
+	return versions, nil
+}
+
+// MarkApplied records the migrations up to and including target as
+// applied without running them, for databases that were set up by
+// hand from the schema files. It returns the versions recorded.
+func (s *SQLStore) MarkApplied(target int64) ([]int64, error) {
+	status, err := s.known()
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []int64
+	for _, m := range status {
+		if m.Applied || m.Version > target {
+			continue
+		}
+
+		_, err = s.db.Exec(insertMigration, m.Version, time.Now().Unix())
+		if err != nil {
+			return versions, err
+		}
+		versions = append(versions, m.Version)
+	}
+
+	return versions, nil
+}
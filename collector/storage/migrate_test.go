@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/kisom/goutils/assert"
+)
+
+func TestMigrations(t *testing.T) {
+	var latest []int64
+	for _, dialect := range []string{DialectPostgres, DialectSQLite} {
+		migrations, err := Migrations(dialect)
+		assert.NoErrorT(t, err)
+		assert.BoolT(t, len(migrations) > 0, dialect)
+
+		for i := 1; i < len(migrations); i++ {
+			assert.BoolT(t, migrations[i].Version > migrations[i-1].Version,
+				"migrations are in order")
+		}
+		latest = append(latest, migrations[len(migrations)-1].Version)
+	}
+
+	// Both dialects move to each new schema together.
+	assert.BoolT(t, latest[0] == latest[1], "latest versions match")
+
+	_, err := Migrations("mysql")
+	assert.ErrorT(t, err)
+}
+
+func TestUnwrap(t *testing.T) {
+	script := "BEGIN;\n\nCREATE TABLE t (id INTEGER);\n\nCOMMIT;\n"
+	assert.BoolT(t, unwrap(script) == "\n\nCREATE TABLE t (id INTEGER);\n\n", "unwrapped")
+
+	script = "CREATE TABLE t (id INTEGER);\n"
+	assert.BoolT(t, unwrap(script) == script, "no transaction")
+}
+
+func TestMigrateSQLite(t *testing.T) {
+	s, err := OpenSQLite(":memory:")
+	assert.NoErrorT(t, err)
+	defer s.Close()
+
+	migrations, err := Migrations(DialectSQLite)
+	assert.NoErrorT(t, err)
+	latest := migrations[len(migrations)-1].Version
+
+	assert.ErrorT(t, s.CheckSchema())
+
+	// Rebuilding the uplinks table keeps what's in it.
+	_, err = s.MigrateUp(migrations[0].Version)
+	assert.NoErrorT(t, err)
+	_, err = s.DB().Exec(`INSERT INTO uplinks (
+	id, app_id, dev_id, hw_serial, port, counter, is_retry, is_confirmed,
+	payload_raw, uplink_time, frequency
+) VALUES ('1', 'fls', 'backyard', '009CB1747141CD05', 1, 7, false, false, 'A', 0, 904.3)`)
+	assert.NoErrorT(t, err)
+	_, err = s.MigrateUp(0)
+	assert.NoErrorT(t, err)
+	u, err := s.LatestUplink()
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, u.Counter == 7 && u.PayloadRaw == "A", "uplink kept")
+	_, err = s.MigrateDown(0)
+	assert.NoErrorT(t, err)
+
+	versions, err := s.MigrateUp(0)
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, len(versions) == len(migrations), "all applied")
+	assert.NoErrorT(t, s.CheckSchema())
+
+	versions, err = s.MigrateUp(0)
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, len(versions) == 0, "nothing left to apply")
+
+	status, err := s.Status()
+	assert.NoErrorT(t, err)
+	for _, m := range status {
+		assert.BoolT(t, m.Applied && !m.Unknown, "status")
+	}
+
+	versions, err = s.MigrateDown(0)
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, len(versions) == len(migrations) && versions[0] == latest,
+		"all undone, newest first")
+	_, err = s.DB().Exec(`SELECT id FROM readings`)
+	assert.ErrorT(t, err)
+
+	versions, err = s.MarkApplied(latest)
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, len(versions) == len(migrations), "marked")
+	assert.NoErrorT(t, s.CheckSchema())
+
+	// The tables were never created, so there's nothing to undo.
+	_, err = s.MigrateDown(0)
+	assert.ErrorT(t, err)
+	_, err = s.DB().Exec(`DELETE FROM schema_migrations`)
+	assert.NoErrorT(t, err)
+
+	_, err = s.MigrateUp(0)
+	assert.NoErrorT(t, err)
+	_, err = s.DB().Exec(insertMigration, latest+1, 0)
+	assert.NoErrorT(t, err)
+	assert.ErrorT(t, s.CheckSchema())
+	_, err = s.MigrateUp(0)
+	assert.ErrorT(t, err)
+
+	status, err = s.Status()
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, status[len(status)-1].Unknown, "unknown version")
+}
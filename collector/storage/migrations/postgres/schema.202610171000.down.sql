@@ -0,0 +1,2 @@
+DROP TABLE lorawan_dev_nonces;
+DROP TABLE lorawan_sessions;
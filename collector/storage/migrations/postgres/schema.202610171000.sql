@@ -0,0 +1,19 @@
+-- Sessions created by the OTAA join server.
+CREATE TABLE lorawan_sessions (
+	dev_eui			TEXT PRIMARY KEY,
+	device			TEXT NOT NULL,
+	app_id			TEXT NOT NULL,
+	dev_addr		TEXT NOT NULL UNIQUE,
+	nwk_s_key		TEXT NOT NULL,
+	app_s_key		TEXT NOT NULL,
+	fcnt_up			BIGINT NOT NULL DEFAULT 0,
+	joined_at		INTEGER NOT NULL
+);
+
+-- DevNonces may only be used once per device.
+CREATE TABLE lorawan_dev_nonces (
+	dev_eui			TEXT NOT NULL,
+	dev_nonce		INTEGER NOT NULL,
+	used_at			INTEGER NOT NULL,
+	PRIMARY KEY (dev_eui, dev_nonce)
+);
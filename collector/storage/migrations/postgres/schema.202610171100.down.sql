@@ -0,0 +1,2 @@
+DROP TABLE receptions;
+DROP TABLE gateways;
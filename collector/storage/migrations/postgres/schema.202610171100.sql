@@ -0,0 +1,27 @@
+-- The most recent location reported by each gateway.
+CREATE TABLE gateways (
+	gtw_id			TEXT PRIMARY KEY,
+	latitude		FLOAT,
+	longitude		FLOAT,
+	altitude		FLOAT,
+	first_seen		INTEGER NOT NULL,
+	last_seen		INTEGER NOT NULL
+);
+
+-- One row per gateway that heard an uplink.
+CREATE TABLE receptions (
+	id			UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	uplink			UUID NOT NULL REFERENCES uplinks,
+	gtw_id			TEXT NOT NULL REFERENCES gateways,
+	gtw_timestamp		BIGINT NOT NULL,
+	gtw_time		INTEGER,
+	channel			INTEGER NOT NULL,
+	rssi			FLOAT NOT NULL,
+	snr			FLOAT NOT NULL,
+	rf_chain		INTEGER NOT NULL,
+	latitude		FLOAT,
+	longitude		FLOAT,
+	altitude		FLOAT
+);
+
+CREATE INDEX receptions_uplink ON receptions (uplink);
@@ -0,0 +1,7 @@
+ALTER TABLE uplinks
+	DROP COLUMN coding_rate,
+	DROP COLUMN latitude,
+	DROP COLUMN longitude,
+	DROP COLUMN altitude,
+	DROP COLUMN payload_fields,
+	DROP COLUMN downlink_url;
@@ -0,0 +1,7 @@
+-- The rest of the TTN v2 uplink metadata.
+ALTER TABLE uplinks ADD COLUMN coding_rate	TEXT NOT NULL DEFAULT '';
+ALTER TABLE uplinks ADD COLUMN latitude		FLOAT;
+ALTER TABLE uplinks ADD COLUMN longitude	FLOAT;
+ALTER TABLE uplinks ADD COLUMN altitude		FLOAT;
+ALTER TABLE uplinks ADD COLUMN payload_fields	JSONB;
+ALTER TABLE uplinks ADD COLUMN downlink_url	TEXT NOT NULL DEFAULT '';
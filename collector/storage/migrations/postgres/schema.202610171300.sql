@@ -0,0 +1,3 @@
+-- The payload layout each reading was decoded with; everything stored
+-- before this came from redenv.ino.
+ALTER TABLE readings ADD COLUMN layout TEXT NOT NULL DEFAULT 'redenv/2';
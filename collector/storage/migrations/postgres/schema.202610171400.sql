@@ -0,0 +1,11 @@
+-- Values decoded by runtime-configured decoders, which don't have a
+-- column of their own in readings.
+CREATE TABLE measurements (
+	id			UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	reading			UUID NOT NULL REFERENCES readings,
+	name			TEXT NOT NULL,
+	value			FLOAT NOT NULL,
+	unit			TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX measurements_reading ON measurements (reading);
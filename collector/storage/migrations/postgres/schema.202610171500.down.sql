@@ -0,0 +1,7 @@
+ALTER TABLE readings
+	DROP COLUMN elevation,
+	DROP COLUMN dew_point,
+	DROP COLUMN heat_index,
+	DROP COLUMN absolute_humidity,
+	DROP COLUMN vapor_pressure_deficit,
+	DROP COLUMN sea_level_pressure;
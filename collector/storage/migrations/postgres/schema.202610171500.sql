@@ -0,0 +1,11 @@
+-- Quantities derived from the temperature, humidity and pressure at
+-- ingest, so that everything downstream uses the same formulas. They
+-- are NULL where they can't be worked out, e.g. the sea-level
+-- pressure for a device without a configured elevation.
+ALTER TABLE readings
+	ADD COLUMN elevation FLOAT,
+	ADD COLUMN dew_point FLOAT,
+	ADD COLUMN heat_index FLOAT,
+	ADD COLUMN absolute_humidity FLOAT,
+	ADD COLUMN vapor_pressure_deficit FLOAT,
+	ADD COLUMN sea_level_pressure FLOAT;
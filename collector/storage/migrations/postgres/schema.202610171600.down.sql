@@ -0,0 +1 @@
+ALTER TABLE readings DROP COLUMN quality;
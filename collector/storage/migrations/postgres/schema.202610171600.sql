@@ -0,0 +1,4 @@
+-- A bitmask of the fields that failed validation; see reading.Flag.
+-- Flagged fields are stored as they were received, but should be left
+-- out of anything computed from them.
+ALTER TABLE readings ADD COLUMN quality INTEGER NOT NULL DEFAULT 0;
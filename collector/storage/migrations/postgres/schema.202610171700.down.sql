@@ -0,0 +1,17 @@
+-- Missing values go back to what the payload uses for them.
+UPDATE readings SET temperature = 0 WHERE temperature IS NULL;
+UPDATE readings SET humidity = 0 WHERE humidity IS NULL;
+UPDATE readings SET pressure = 0 WHERE pressure IS NULL;
+UPDATE readings SET co2 = -1 WHERE co2 IS NULL;
+UPDATE readings SET tvoc = -1 WHERE tvoc IS NULL;
+UPDATE readings SET fix = false WHERE fix IS NULL;
+UPDATE readings SET sats = 0 WHERE sats IS NULL;
+
+ALTER TABLE readings
+	ALTER COLUMN temperature SET NOT NULL,
+	ALTER COLUMN humidity SET NOT NULL,
+	ALTER COLUMN pressure SET NOT NULL,
+	ALTER COLUMN co2 SET NOT NULL,
+	ALTER COLUMN tvoc SET NOT NULL,
+	ALTER COLUMN fix SET NOT NULL,
+	ALTER COLUMN sats SET NOT NULL;
@@ -0,0 +1,34 @@
+-- Sensor values are NULL when the sensor isn't fitted or failed, so
+-- that they don't drag averages towards 0 or -1.
+ALTER TABLE readings
+	ALTER COLUMN temperature DROP NOT NULL,
+	ALTER COLUMN humidity DROP NOT NULL,
+	ALTER COLUMN pressure DROP NOT NULL,
+	ALTER COLUMN co2 DROP NOT NULL,
+	ALTER COLUMN tvoc DROP NOT NULL;
+
+-- The collector has been inserting fix and sats, but the first schema
+-- doesn't create them; add them if they're missing so that nodes
+-- without a GPS can store NULLs in them.
+ALTER TABLE readings
+	ADD COLUMN IF NOT EXISTS fix BOOLEAN,
+	ADD COLUMN IF NOT EXISTS sats INTEGER;
+ALTER TABLE readings
+	ALTER COLUMN fix DROP NOT NULL,
+	ALTER COLUMN sats DROP NOT NULL;
+
+-- Hardware bits, from reading.HardwareBME280 and friends.
+UPDATE readings
+SET temperature = NULL, humidity = NULL, pressure = NULL
+WHERE hardware & 1 = 0;
+
+UPDATE readings
+SET co2 = NULL, tvoc = NULL
+WHERE hardware & 2 = 0 OR ccs811_status <> 0;
+
+UPDATE readings SET co2 = NULL WHERE co2 = -1;
+UPDATE readings SET tvoc = NULL WHERE tvoc = -1;
+
+UPDATE readings
+SET fix = NULL, sats = NULL
+WHERE hardware & 16 = 0;
@@ -0,0 +1,3 @@
+ALTER TABLE readings
+	DROP COLUMN time_corrected,
+	DROP COLUMN recorded_at_original;
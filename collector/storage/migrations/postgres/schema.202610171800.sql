@@ -0,0 +1,6 @@
+-- Readings whose clock was implausible have recorded_at reconstructed
+-- from the receive time or the device's uptime; the time the node
+-- sent is kept in recorded_at_original.
+ALTER TABLE readings
+	ADD COLUMN time_corrected BOOLEAN NOT NULL DEFAULT false,
+	ADD COLUMN recorded_at_original INTEGER;
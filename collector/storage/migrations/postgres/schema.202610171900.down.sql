@@ -0,0 +1,2 @@
+ALTER TABLE readings DROP COLUMN ccs811_conditioning;
+DROP TABLE sensors;
@@ -0,0 +1,14 @@
+-- When each device's sensors were first seen, for the CCS811's 48 hour
+-- burn-in. Delete a device's row after replacing its sensor.
+CREATE TABLE sensors (
+	device			TEXT NOT NULL,
+	sensor			TEXT NOT NULL,
+	first_seen		INTEGER NOT NULL,
+	PRIMARY KEY (device, sensor)
+);
+
+-- Why a reading's CO2 and TVOC can't be used yet; see
+-- reading.Conditioning. Conditioning readings also have the co2 and
+-- tvoc bits set in quality, so they drop out of anything that filters
+-- on it.
+ALTER TABLE readings ADD COLUMN ccs811_conditioning INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+ALTER TABLE readings
+	DROP COLUMN temperature_corrected,
+	DROP COLUMN humidity_corrected,
+	DROP COLUMN pressure_corrected;
+DROP TABLE calibrations;
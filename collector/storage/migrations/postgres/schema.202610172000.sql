@@ -0,0 +1,26 @@
+-- Per-device calibration profiles. A value is first looked up in the
+-- optional piecewise table, a JSON list of [raw, corrected] pairs
+-- sorted by the raw value; it is then multiplied by gain and offset is
+-- added. A profile applies to readings recorded in [valid_from,
+-- valid_until); NULL leaves that end open. See reading.Calibration.
+CREATE TABLE calibrations (
+	id			UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	device			TEXT NOT NULL,
+	quantity		TEXT NOT NULL
+		CHECK (quantity IN ('temperature', 'humidity', 'pressure')),
+	offset_value		FLOAT NOT NULL DEFAULT 0,
+	gain			FLOAT NOT NULL DEFAULT 1,
+	points			JSONB,
+	valid_from		INTEGER,
+	valid_until		INTEGER
+);
+
+CREATE INDEX calibrations_device ON calibrations (device);
+
+-- temperature, humidity and pressure keep the values the node sent;
+-- these hold the calibrated values, if a calibration applied when the
+-- reading was stored.
+ALTER TABLE readings
+	ADD COLUMN temperature_corrected FLOAT,
+	ADD COLUMN humidity_corrected FLOAT,
+	ADD COLUMN pressure_corrected FLOAT;
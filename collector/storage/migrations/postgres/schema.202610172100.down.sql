@@ -0,0 +1,6 @@
+DROP TABLE uplink_duplicates;
+
+ALTER TABLE uplinks
+	DROP CONSTRAINT uplinks_dev_id_counter_payload_raw_key,
+	ADD CONSTRAINT uplinks_dev_id_hw_serial_payload_raw_key
+		UNIQUE (dev_id, hw_serial, payload_raw);
@@ -0,0 +1,14 @@
+-- An uplink is the same as one already stored if it came from the same
+-- device with the same frame counter and payload; webhooks that are
+-- delivered twice are counted here rather than stored again. The old
+-- constraint rejected a node sending the same payload twice.
+ALTER TABLE uplinks
+	DROP CONSTRAINT IF EXISTS uplinks_dev_id_hw_serial_payload_raw_key,
+	ADD CONSTRAINT uplinks_dev_id_counter_payload_raw_key
+		UNIQUE (dev_id, counter, payload_raw);
+
+CREATE TABLE uplink_duplicates (
+	device			TEXT PRIMARY KEY,
+	count			BIGINT NOT NULL,
+	last_seen		INTEGER NOT NULL
+);
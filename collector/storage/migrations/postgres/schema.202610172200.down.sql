@@ -0,0 +1 @@
+DROP INDEX readings_uplink;
@@ -0,0 +1,3 @@
+-- Readings are looked up by their uplink when stored payloads are
+-- decoded again.
+CREATE INDEX readings_uplink ON readings (uplink);
@@ -0,0 +1,9 @@
+DROP TABLE calibrations;
+DROP TABLE sensors;
+DROP TABLE lorawan_dev_nonces;
+DROP TABLE lorawan_sessions;
+DROP TABLE receptions;
+DROP TABLE gateways;
+DROP TABLE measurements;
+DROP TABLE readings;
+DROP TABLE uplinks;
@@ -0,0 +1,139 @@
+-- SQLite starts from the Postgres schema as of its
+-- schema.202610172000.sql, in SQLite's dialect: UUIDs and JSON are
+-- held as text, and booleans as integers.
+
+CREATE TABLE uplinks (
+	id			TEXT PRIMARY KEY,
+	app_id			TEXT NOT NULL,
+	dev_id			TEXT NOT NULL,
+	hw_serial		TEXT NOT NULL,
+	port			INTEGER NOT NULL,
+	counter			INTEGER NOT NULL,
+	is_retry		BOOLEAN NOT NULL,
+	is_confirmed		BOOLEAN NOT NULL,
+	payload_raw		TEXT NOT NULL,
+	uplink_time		INTEGER NOT NULL,
+	frequency		FLOAT NOT NULL,
+	modulation		TEXT NOT NULL DEFAULT 'simulated',
+	data_rate		TEXT NOT NULL DEFAULT 'simulated',
+	bit_rate		TEXT NOT NULL DEFAULT 'simulated',
+	coding_rate		TEXT NOT NULL DEFAULT '',
+	latitude		FLOAT,
+	longitude		FLOAT,
+	altitude		FLOAT,
+	payload_fields		TEXT,
+	downlink_url		TEXT NOT NULL DEFAULT '',
+	unique(dev_id, hw_serial, payload_raw)
+);
+
+CREATE TABLE readings (
+	id			TEXT PRIMARY KEY,
+	received_at		INTEGER NOT NULL,
+	device			TEXT NOT NULL,
+	uplink			TEXT REFERENCES uplinks,
+	recorded_at		INTEGER NOT NULL,
+	hardware		INTEGER NOT NULL,
+	uptime			INTEGER NOT NULL,
+	temperature		FLOAT,
+	temperature_cal		FLOAT NOT NULL,
+	temperature_is_cal	BOOLEAN NOT NULL,
+	humidity		FLOAT,
+	pressure		FLOAT,
+	ccs811_status		INTEGER NOT NULL,
+	co2			INTEGER,
+	tvoc			INTEGER,
+	voltage			INTEGER NOT NULL,
+	fix			BOOLEAN,
+	sats			INTEGER,
+	layout			TEXT NOT NULL DEFAULT 'redenv/2',
+	elevation		FLOAT,
+	dew_point		FLOAT,
+	heat_index		FLOAT,
+	absolute_humidity	FLOAT,
+	vapor_pressure_deficit	FLOAT,
+	sea_level_pressure	FLOAT,
+	quality			INTEGER NOT NULL DEFAULT 0,
+	time_corrected		BOOLEAN NOT NULL DEFAULT false,
+	recorded_at_original	INTEGER,
+	ccs811_conditioning	INTEGER NOT NULL DEFAULT 0,
+	temperature_corrected	FLOAT,
+	humidity_corrected	FLOAT,
+	pressure_corrected	FLOAT
+);
+
+CREATE INDEX readings_device ON readings (device, recorded_at);
+
+CREATE TABLE measurements (
+	id			TEXT PRIMARY KEY,
+	reading			TEXT NOT NULL REFERENCES readings,
+	name			TEXT NOT NULL,
+	value			FLOAT NOT NULL,
+	unit			TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX measurements_reading ON measurements (reading);
+
+CREATE TABLE gateways (
+	gtw_id			TEXT PRIMARY KEY,
+	latitude		FLOAT,
+	longitude		FLOAT,
+	altitude		FLOAT,
+	first_seen		INTEGER NOT NULL,
+	last_seen		INTEGER NOT NULL
+);
+
+CREATE TABLE receptions (
+	id			TEXT PRIMARY KEY,
+	uplink			TEXT NOT NULL REFERENCES uplinks,
+	gtw_id			TEXT NOT NULL REFERENCES gateways,
+	gtw_timestamp		BIGINT NOT NULL,
+	gtw_time		INTEGER,
+	channel			INTEGER NOT NULL,
+	rssi			FLOAT NOT NULL,
+	snr			FLOAT NOT NULL,
+	rf_chain		INTEGER NOT NULL,
+	latitude		FLOAT,
+	longitude		FLOAT,
+	altitude		FLOAT
+);
+
+CREATE INDEX receptions_uplink ON receptions (uplink);
+
+CREATE TABLE lorawan_sessions (
+	dev_eui			TEXT PRIMARY KEY,
+	device			TEXT NOT NULL,
+	app_id			TEXT NOT NULL,
+	dev_addr		TEXT NOT NULL UNIQUE,
+	nwk_s_key		TEXT NOT NULL,
+	app_s_key		TEXT NOT NULL,
+	fcnt_up			BIGINT NOT NULL DEFAULT 0,
+	joined_at		INTEGER NOT NULL
+);
+
+CREATE TABLE lorawan_dev_nonces (
+	dev_eui			TEXT NOT NULL,
+	dev_nonce		INTEGER NOT NULL,
+	used_at			INTEGER NOT NULL,
+	PRIMARY KEY (dev_eui, dev_nonce)
+);
+
+CREATE TABLE sensors (
+	device			TEXT NOT NULL,
+	sensor			TEXT NOT NULL,
+	first_seen		INTEGER NOT NULL,
+	PRIMARY KEY (device, sensor)
+);
+
+CREATE TABLE calibrations (
+	id			TEXT PRIMARY KEY,
+	device			TEXT NOT NULL,
+	quantity		TEXT NOT NULL
+		CHECK (quantity IN ('temperature', 'humidity', 'pressure')),
+	offset_value		FLOAT NOT NULL DEFAULT 0,
+	gain			FLOAT NOT NULL DEFAULT 1,
+	points			TEXT,
+	valid_from		INTEGER,
+	valid_until		INTEGER
+);
+
+CREATE INDEX calibrations_device ON calibrations (device);
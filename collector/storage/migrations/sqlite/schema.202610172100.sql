@@ -0,0 +1,37 @@
+-- An uplink is the same as one already stored if it came from the same
+-- device with the same frame counter and payload; webhooks that are
+-- delivered twice are counted here rather than stored again. SQLite
+-- can't drop a constraint, so the table is rebuilt.
+CREATE TABLE uplinks_new (
+	id			TEXT PRIMARY KEY,
+	app_id			TEXT NOT NULL,
+	dev_id			TEXT NOT NULL,
+	hw_serial		TEXT NOT NULL,
+	port			INTEGER NOT NULL,
+	counter			INTEGER NOT NULL,
+	is_retry		BOOLEAN NOT NULL,
+	is_confirmed		BOOLEAN NOT NULL,
+	payload_raw		TEXT NOT NULL,
+	uplink_time		INTEGER NOT NULL,
+	frequency		FLOAT NOT NULL,
+	modulation		TEXT NOT NULL DEFAULT 'simulated',
+	data_rate		TEXT NOT NULL DEFAULT 'simulated',
+	bit_rate		TEXT NOT NULL DEFAULT 'simulated',
+	coding_rate		TEXT NOT NULL DEFAULT '',
+	latitude		FLOAT,
+	longitude		FLOAT,
+	altitude		FLOAT,
+	payload_fields		TEXT,
+	downlink_url		TEXT NOT NULL DEFAULT '',
+	unique(dev_id, counter, payload_raw)
+);
+
+INSERT INTO uplinks_new SELECT * FROM uplinks;
+DROP TABLE uplinks;
+ALTER TABLE uplinks_new RENAME TO uplinks;
+
+CREATE TABLE uplink_duplicates (
+	device			TEXT PRIMARY KEY,
+	count			BIGINT NOT NULL,
+	last_seen		INTEGER NOT NULL
+);
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// OpenPostgres connects to a Postgres database. The schema is created
+// by MigrateUp.
+func OpenPostgres(connStr string) (*SQLStore, error) {
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLStore{db: db, dialect: DialectPostgres}, nil
+}
+
+// pqUnavailable reports whether Postgres refused a query because the
+// server is going away, out of resources or unable to serialize the
+// transaction, rather than because of the query.
+func pqUnavailable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+
+	switch pqErr.Code.Class() {
+	case "08", // connection exception
+		"40", // transaction rollback
+		"53", // insufficient resources
+		"57": // operator intervention
+		return true
+	}
+	return false
+}
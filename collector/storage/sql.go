@@ -0,0 +1,951 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kisom/redenv/collector/lorawan"
+	"github.com/kisom/redenv/collector/reading"
+	"github.com/kisom/redenv/collector/ttn"
+)
+
+// The queries are written to run on both Postgres and SQLite. IDs are
+// generated here rather than by the database, as SQLite has no
+// gen_random_uuid.
+var (
+	insertReading = `INSERT INTO readings (
+	id,
+	received_at,
+	device,
+	uplink,
+	recorded_at,
+	hardware,
+	uptime,
+	temperature,
+	temperature_cal,
+	temperature_is_cal,
+	humidity,
+	pressure,
+	ccs811_status,
+	co2,
+	tvoc,
+	voltage,
+	fix,
+	sats,
+	layout,
+	elevation,
+	dew_point,
+	heat_index,
+	absolute_humidity,
+	vapor_pressure_deficit,
+	sea_level_pressure,
+	quality,
+	time_corrected,
+	recorded_at_original,
+	ccs811_conditioning,
+	temperature_corrected,
+	humidity_corrected,
+	pressure_corrected
+) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18,
+	$19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32)`
+	readingColumns = `
+	id, received_at, device, uplink, recorded_at, hardware, uptime,
+	temperature, temperature_cal, temperature_is_cal, humidity, pressure,
+	ccs811_status, co2, tvoc, voltage, fix, sats, layout, elevation,
+	quality, time_corrected, recorded_at_original, ccs811_conditioning,
+	temperature_corrected, humidity_corrected, pressure_corrected`
+	selectReadings = `SELECT` + readingColumns + `
+FROM readings`
+	selectLatest = selectReadings + `
+WHERE device = $1
+ORDER BY recorded_at DESC
+LIMIT 1`
+	selectRange = selectReadings + `
+WHERE device = $1 AND recorded_at >= $2 AND recorded_at < $3
+ORDER BY recorded_at`
+	selectReadingFor = `SELECT` + readingColumns + `,
+	dew_point, heat_index, absolute_humidity, vapor_pressure_deficit,
+	sea_level_pressure
+FROM readings
+WHERE uplink = $1
+LIMIT 1`
+	deleteMeasurements = `DELETE FROM measurements
+WHERE reading IN (SELECT id FROM readings WHERE uplink = $1)`
+	deleteReadings = `DELETE FROM readings WHERE uplink = $1`
+	insertUplink   = `INSERT INTO uplinks (
+	id,
+	app_id,
+	dev_id,
+	hw_serial,
+	port,
+	counter,
+	is_retry,
+	is_confirmed,
+	payload_raw,
+	uplink_time,
+	frequency,
+	modulation,
+	data_rate,
+	bit_rate,
+	coding_rate,
+	latitude,
+	longitude,
+	altitude,
+	payload_fields,
+	downlink_url
+) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14,
+	$15, $16, $17, $18, $19, $20)
+ON CONFLICT (dev_id, counter, payload_raw) DO NOTHING`
+	selectUplinkID = `SELECT id FROM uplinks
+WHERE dev_id = $1 AND counter = $2 AND payload_raw = $3`
+	countDuplicate = `INSERT INTO uplink_duplicates (device, count, last_seen)
+VALUES ($1, 1, $2)
+ON CONFLICT (device) DO UPDATE SET
+	count = uplink_duplicates.count + 1,
+	last_seen = excluded.last_seen`
+	selectDuplicates = `SELECT device, count FROM uplink_duplicates`
+	selectUplinks    = `SELECT
+	id, app_id, dev_id, hw_serial, port, counter,
+	is_retry, is_confirmed, payload_raw, uplink_time,
+	frequency, modulation, data_rate, bit_rate, coding_rate,
+	latitude, longitude, altitude, payload_fields, downlink_url
+FROM uplinks`
+	selectLatestUplink = selectUplinks + `
+ORDER BY uplink_time DESC
+LIMIT 1`
+	selectUplinkRange = selectUplinks + `
+WHERE dev_id = $1 AND uplink_time >= $2 AND uplink_time < $3
+ORDER BY uplink_time, counter`
+	upsertGateway = `INSERT INTO gateways (
+	gtw_id,
+	latitude,
+	longitude,
+	altitude,
+	first_seen,
+	last_seen
+) VALUES ($1, $2, $3, $4, $5, $5)
+ON CONFLICT (gtw_id) DO UPDATE SET
+	latitude = COALESCE(excluded.latitude, gateways.latitude),
+	longitude = COALESCE(excluded.longitude, gateways.longitude),
+	altitude = COALESCE(excluded.altitude, gateways.altitude),
+	last_seen = excluded.last_seen`
+	insertReception = `INSERT INTO receptions (
+	id,
+	uplink,
+	gtw_id,
+	gtw_timestamp,
+	gtw_time,
+	channel,
+	rssi,
+	snr,
+	rf_chain,
+	latitude,
+	longitude,
+	altitude
+) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+	countReceptions = `SELECT COUNT(*) FROM receptions
+WHERE uplink = $1 AND gtw_id = $2`
+	selectReceptions = `SELECT
+	gtw_id, gtw_timestamp, gtw_time, channel, rssi, snr, rf_chain,
+	latitude, longitude, altitude
+FROM receptions
+WHERE uplink = $1
+ORDER BY rssi DESC`
+	insertSensor = `INSERT INTO sensors (device, sensor, first_seen)
+VALUES ($1, $2, $3)
+ON CONFLICT (device, sensor) DO NOTHING`
+	selectSensor = `SELECT first_seen FROM sensors
+WHERE device = $1 AND sensor = $2`
+	selectCalibrations = `SELECT
+	quantity, offset_value, gain, points, valid_from, valid_until
+FROM calibrations
+WHERE device = $1`
+	insertMeasurement = `INSERT INTO measurements (
+	id,
+	reading,
+	name,
+	value,
+	unit
+) VALUES ($1, $2, $3, $4, $5)`
+	selectMeasurements = `SELECT name, value, unit
+FROM measurements
+WHERE reading = $1`
+)
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// scanner is satisfied by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+var _ Store = (*SQLStore)(nil)
+
+// SQL dialects, which each have their own migrations.
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite"
+)
+
+// SQLStore is a Store backed by a SQL database.
+type SQLStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+// DB returns the underlying database.
+func (s *SQLStore) DB() *sql.DB { return s.db }
+
+func (s *SQLStore) Close() error { return s.db.Close() }
+
+// newID returns a random UUID for a new row.
+func newID() (string, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+func (s *SQLStore) InsertUplink(u *ttn.Uplink, receivedAt time.Time) (string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	id, err := insertUplinkTx(tx, u, receivedAt)
+	if err != nil && err != ErrDuplicate {
+		tx.Rollback()
+		return "", err
+	}
+
+	if cerr := tx.Commit(); cerr != nil {
+		return "", cerr
+	}
+	return id, err
+}
+
+func (s *SQLStore) InsertReading(r *reading.Reading) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err = insertReadingTx(tx, r); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) StoreUplink(r *reading.Reading, u *ttn.Uplink) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	r.Uplink, err = insertUplinkTx(tx, u, r.ReceivedAt)
+	if err == ErrDuplicate {
+		// The reading was stored with the uplink the first time;
+		// only the count of duplicates changes.
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+		return ErrDuplicate
+	} else if err != nil {
+		// TODO: Could be a doule error, but not worth figuring out right now.
+		tx.Rollback()
+		return err
+	}
+
+	err = insertReadingTx(tx, r)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertUplinkTx stores an uplink and each gateway's reception of
+// it. If the uplink has already been stored, it counts the duplicate
+// and returns the stored uplink's ID with ErrDuplicate.
+func insertUplinkTx(q querier, u *ttn.Uplink, receivedAt time.Time) (string, error) {
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+
+	received := receivedAt.Unix()
+	res, err := q.Exec(insertUplink, id, u.AppID, u.DevID, u.HardwareSerial,
+		u.Port, u.Counter, u.IsRetry, u.Confirmed, u.PayloadRaw,
+		received, u.Metadata.Frequency, u.Metadata.Modulation,
+		u.Metadata.DataRate, u.Metadata.BitRate, u.Metadata.CodingRate,
+		u.Metadata.Latitude, u.Metadata.Longitude, u.Metadata.Altitude,
+		payloadFields(u), u.DownlinkURL)
+	if err != nil {
+		return "", err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+
+	if n == 0 {
+		err = q.QueryRow(selectUplinkID, u.DevID, u.Counter, u.PayloadRaw).Scan(&id)
+		if err != nil {
+			return "", err
+		}
+
+		if _, err = q.Exec(countDuplicate, u.DevID, received); err != nil {
+			return "", err
+		}
+		return id, ErrDuplicate
+	}
+
+	for _, gw := range u.Metadata.Gateways {
+		if err = insertReceptionTx(q, id, gw, received); err != nil {
+			return "", err
+		}
+	}
+
+	return id, nil
+}
+
+// insertReceptionTx stores a gateway's reception of an uplink.
+func insertReceptionTx(q querier, uplink string, gw ttn.Gateway, received int64) error {
+	var gwTime *int64
+	if t, err := time.Parse(time.RFC3339, gw.Time); err == nil {
+		unix := t.Unix()
+		gwTime = &unix
+	}
+
+	_, err := q.Exec(upsertGateway, gw.GatewayID,
+		gw.Latitude, gw.Longitude, gw.Altitude, received)
+	if err != nil {
+		return err
+	}
+
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+
+	_, err = q.Exec(insertReception, id, uplink, gw.GatewayID,
+		gw.Timestamp, gwTime, gw.Channel, gw.RSSI, gw.SNR,
+		gw.RFChain, gw.Latitude, gw.Longitude, gw.Altitude)
+	return err
+}
+
+func (s *SQLStore) AddReceptions(u *ttn.Uplink, receivedAt time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var id string
+	err = tx.QueryRow(selectUplinkID, u.DevID, u.Counter, u.PayloadRaw).Scan(&id)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return ErrNotFound
+	} else if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, gw := range u.Metadata.Gateways {
+		var n int
+		err = tx.QueryRow(countReceptions, id, gw.GatewayID).Scan(&n)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if n > 0 {
+			continue
+		}
+
+		if err = insertReceptionTx(tx, id, gw, receivedAt.Unix()); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// insertReadingTx stores a reading and its measurements, keeping its
+// ID if it has one.
+func insertReadingTx(q querier, r *reading.Reading) error {
+	id := r.ID
+	if id == "" {
+		var err error
+		if id, err = newID(); err != nil {
+			return err
+		}
+	}
+
+	// The sensor columns hold what the node sent, so that the
+	// calibrations can be revised later.
+	raw := r.Uncalibrated()
+	var corrected reading.Reading
+	if r.Raw != nil {
+		corrected = *r
+	}
+	d := Derive(r)
+
+	_, err := q.Exec(insertReading, id, r.ReceivedAt.Unix(), r.Device, r.Uplink,
+		r.When.Unix(), r.Hardware, r.Uptime,
+		raw.NullTemperature(), r.TemperatureCalibration, r.TemperatureCalibrated,
+		raw.NullHumidity(), raw.NullPressure(),
+		r.CCS811Status, r.NullCO2(), r.NullTVOC(), r.Voltage,
+		r.NullFix(), r.NullSats(),
+		r.Layout, r.Elevation, nullFloat(d.DewPoint), nullFloat(d.HeatIndex),
+		nullFloat(d.AbsoluteHumidity), nullFloat(d.VaporPressureDeficit),
+		nullFloat(d.SeaLevelPressure), r.Quality,
+		r.TimeCorrected, originalTime(r), r.Conditioning,
+		corrected.NullTemperature(), corrected.NullHumidity(),
+		corrected.NullPressure())
+	if err != nil {
+		return err
+	}
+	r.ID = id
+
+	for _, m := range r.Measurements {
+		mID, err := newID()
+		if err != nil {
+			return err
+		}
+
+		_, err = q.Exec(insertMeasurement, mID, r.ID, m.Name, m.Value, m.Unit)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanReading rebuilds a reading from a row selected by
+// selectReadings. Missing sensor values come back as the values the
+// payload uses for them.
+func scanReading(row scanner) (*reading.Reading, error) {
+	r := &reading.Reading{}
+	var receivedAt, when int64
+	var temperature, humidity, pressure sql.NullFloat64
+	var co2, tvoc, sats, original sql.NullInt64
+	var fix sql.NullBool
+	var elevation sql.NullFloat64
+	var tempCorrected, humCorrected, presCorrected sql.NullFloat64
+
+	err := row.Scan(&r.ID, &receivedAt, &r.Device, &r.Uplink, &when,
+		&r.Hardware, &r.Uptime,
+		&temperature, &r.TemperatureCalibration, &r.TemperatureCalibrated,
+		&humidity, &pressure,
+		&r.CCS811Status, &co2, &tvoc, &r.Voltage, &fix, &sats,
+		&r.Layout, &elevation,
+		&r.Quality, &r.TimeCorrected, &original, &r.Conditioning,
+		&tempCorrected, &humCorrected, &presCorrected)
+	if err != nil {
+		return nil, err
+	}
+
+	r.ReceivedAt = time.Unix(receivedAt, 0)
+	r.When = time.Unix(when, 0)
+	if original.Valid {
+		r.OriginalWhen = time.Unix(original.Int64, 0)
+	}
+
+	r.Temperature = float32(temperature.Float64)
+	r.Humidity = float32(humidity.Float64)
+	r.Pressure = float32(pressure.Float64)
+
+	r.CO2, r.TVOC = -1, -1
+	if co2.Valid {
+		r.CO2 = int32(co2.Int64)
+	}
+
+	if tvoc.Valid {
+		r.TVOC = int32(tvoc.Int64)
+	}
+
+	r.Fix = fix.Bool
+	r.Sats = uint8(sats.Int64)
+
+	// A NULL for hardware the node has means the payload didn't
+	// carry the value.
+	if r.HasBME280() {
+		for field, v := range map[reading.Flag]sql.NullFloat64{
+			reading.FlagTemperature: temperature,
+			reading.FlagHumidity:    humidity,
+			reading.FlagPressure:    pressure,
+		} {
+			if !v.Valid {
+				r.Missing |= field
+			}
+		}
+	}
+
+	if r.HasGPS() && !sats.Valid {
+		r.Missing |= reading.FlagGPS
+	}
+
+	if elevation.Valid {
+		r.Elevation = &elevation.Float64
+	}
+
+	if tempCorrected.Valid || humCorrected.Valid || presCorrected.Valid {
+		r.Raw = &reading.Uncalibrated{
+			Temperature: r.Temperature,
+			Humidity:    r.Humidity,
+			Pressure:    r.Pressure,
+		}
+		r.Temperature = float32(tempCorrected.Float64)
+		r.Humidity = float32(humCorrected.Float64)
+		r.Pressure = float32(presCorrected.Float64)
+	}
+
+	return r, nil
+}
+
+// loadMeasurements fills in a reading's measurements.
+func (s *SQLStore) loadMeasurements(r *reading.Reading) error {
+	rows, err := s.db.Query(selectMeasurements, r.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m reading.Measurement
+		if err = rows.Scan(&m.Name, &m.Value, &m.Unit); err != nil {
+			return err
+		}
+		r.Measurements = append(r.Measurements, m)
+	}
+
+	return rows.Err()
+}
+
+func (s *SQLStore) Latest(device string) (*reading.Reading, error) {
+	r, err := scanReading(s.db.QueryRow(selectLatest, device))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = s.loadMeasurements(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *SQLStore) Readings(device string, from, to time.Time) ([]*reading.Reading, error) {
+	rows, err := s.db.Query(selectRange, device, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var readings []*reading.Reading
+	for rows.Next() {
+		r, err := scanReading(rows)
+		if err != nil {
+			return nil, err
+		}
+		readings = append(readings, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The measurements are loaded once all the rows have been read,
+	// as SQLite only has the one connection.
+	for _, r := range readings {
+		if err = s.loadMeasurements(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return readings, nil
+}
+
+// scanUplink rebuilds an uplink, without its gateways, from a row
+// selected by selectUplinks.
+func scanUplink(row scanner) (*StoredUplink, error) {
+	u := &ttn.Uplink{}
+	su := &StoredUplink{Uplink: u}
+	var timestamp int64
+	var fields sql.NullString
+
+	err := row.Scan(
+		&su.ID, &u.AppID, &u.DevID, &u.HardwareSerial, &u.Port,
+		&u.Counter, &u.IsRetry, &u.Confirmed, &u.PayloadRaw,
+		&timestamp, &u.Metadata.Frequency, &u.Metadata.Modulation,
+		&u.Metadata.DataRate, &u.Metadata.BitRate, &u.Metadata.CodingRate,
+		&u.Metadata.Latitude, &u.Metadata.Longitude, &u.Metadata.Altitude,
+		&fields, &u.DownlinkURL,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	su.ReceivedAt = time.Unix(timestamp, 0)
+	u.Metadata.Time = uplinkTime(u.DevID, timestamp)
+	if fields.Valid {
+		u.PayloadFields = json.RawMessage(fields.String)
+	}
+	return su, nil
+}
+
+func (s *SQLStore) LatestUplink() (*ttn.Uplink, error) {
+	su, err := scanUplink(s.db.QueryRow(selectLatestUplink))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	su.Uplink.Metadata.Gateways, err = s.gateways(su.ID)
+	if err != nil {
+		return nil, err
+	}
+	return su.Uplink, nil
+}
+
+func (s *SQLStore) Uplinks(device string, from, to time.Time) ([]*StoredUplink, error) {
+	rows, err := s.db.Query(selectUplinkRange, device, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var uplinks []*StoredUplink
+	for rows.Next() {
+		su, err := scanUplink(rows)
+		if err != nil {
+			return nil, err
+		}
+		uplinks = append(uplinks, su)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, su := range uplinks {
+		su.Uplink.Metadata.Gateways, err = s.gateways(su.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return uplinks, nil
+}
+
+// derivedScanner scans the derived columns that follow those
+// scanReading expects.
+type derivedScanner struct {
+	scanner
+	derived [5]sql.NullFloat64
+}
+
+func (ds *derivedScanner) Scan(dest ...interface{}) error {
+	for i := range ds.derived {
+		dest = append(dest, &ds.derived[i])
+	}
+	return ds.scanner.Scan(dest...)
+}
+
+// value returns the ith derived column, or NaN if it's NULL.
+func (ds *derivedScanner) value(i int) float64 {
+	if !ds.derived[i].Valid {
+		return math.NaN()
+	}
+	return ds.derived[i].Float64
+}
+
+func (s *SQLStore) ReadingFor(uplink string) (*StoredReading, error) {
+	ds := &derivedScanner{scanner: s.db.QueryRow(selectReadingFor, uplink)}
+	r, err := scanReading(ds)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = s.loadMeasurements(r); err != nil {
+		return nil, err
+	}
+
+	return &StoredReading{
+		Reading: r,
+		Derived: Derived{
+			DewPoint:             ds.value(0),
+			HeatIndex:            ds.value(1),
+			AbsoluteHumidity:     ds.value(2),
+			VaporPressureDeficit: ds.value(3),
+			SeaLevelPressure:     ds.value(4),
+		},
+	}, nil
+}
+
+// deleteReadingsTx deletes the readings decoded from an uplink.
+func deleteReadingsTx(q querier, uplink string) error {
+	if _, err := q.Exec(deleteMeasurements, uplink); err != nil {
+		return err
+	}
+
+	_, err := q.Exec(deleteReadings, uplink)
+	return err
+}
+
+func (s *SQLStore) ReplaceReadings(readings []*reading.Reading, removed []string, sensors []Sensor) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, uplink := range removed {
+		if err = deleteReadingsTx(tx, uplink); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	for _, r := range readings {
+		if err = deleteReadingsTx(tx, r.Uplink); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err = insertReadingTx(tx, r); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	for _, sensor := range sensors {
+		_, err = tx.Exec(insertSensor, sensor.Device, sensor.Sensor, sensor.FirstSeen.Unix())
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// gateways returns the receptions stored for an uplink.
+func (s *SQLStore) gateways(uplink string) ([]ttn.Gateway, error) {
+	rows, err := s.db.Query(selectReceptions, uplink)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var gateways []ttn.Gateway
+	for rows.Next() {
+		var gw ttn.Gateway
+		var gwTime sql.NullInt64
+
+		err = rows.Scan(&gw.GatewayID, &gw.Timestamp, &gwTime,
+			&gw.Channel, &gw.RSSI, &gw.SNR, &gw.RFChain,
+			&gw.Latitude, &gw.Longitude, &gw.Altitude)
+		if err != nil {
+			return nil, err
+		}
+
+		if gwTime.Valid {
+			gw.Time = time.Unix(gwTime.Int64, 0).UTC().Format(time.RFC3339)
+		}
+		gateways = append(gateways, gw)
+	}
+
+	return gateways, rows.Err()
+}
+
+// Calibrations returns a device's calibration profiles. The points of
+// a piecewise table are stored as a JSON list of [raw, value] pairs.
+func (s *SQLStore) Calibrations(device string) ([]reading.Calibration, error) {
+	rows, err := s.db.Query(selectCalibrations, device)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cals []reading.Calibration
+	for rows.Next() {
+		c := reading.Calibration{Device: device}
+		var points sql.NullString
+		var from, until sql.NullInt64
+
+		err = rows.Scan(&c.Quantity, &c.Offset, &c.Gain, &points, &from, &until)
+		if err != nil {
+			return nil, err
+		}
+
+		if points.Valid {
+			var pairs [][2]float64
+			if err = json.Unmarshal([]byte(points.String), &pairs); err != nil {
+				return nil, fmt.Errorf("storage: bad %s calibration table for %s: %s",
+					c.Quantity, device, err)
+			}
+
+			for _, p := range pairs {
+				c.Table = append(c.Table, reading.CalibrationPoint{Raw: p[0], Value: p[1]})
+			}
+		}
+
+		if from.Valid {
+			c.ValidFrom = time.Unix(from.Int64, 0)
+		}
+
+		if until.Valid {
+			c.ValidUntil = time.Unix(until.Int64, 0)
+		}
+
+		if err = c.Validate(); err != nil {
+			return nil, err
+		}
+		cals = append(cals, c)
+	}
+
+	return cals, rows.Err()
+}
+
+func (s *SQLStore) Duplicates() (map[string]int64, error) {
+	rows, err := s.db.Query(selectDuplicates)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	duplicates := map[string]int64{}
+	for rows.Next() {
+		var device string
+		var count int64
+		if err = rows.Scan(&device, &count); err != nil {
+			return nil, err
+		}
+		duplicates[device] = count
+	}
+
+	return duplicates, rows.Err()
+}
+
+func (s *SQLStore) SensorFirstSeen(device, sensor string, when time.Time) (time.Time, error) {
+	_, err := s.db.Exec(insertSensor, device, sensor, when.Unix())
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return s.SensorSeen(device, sensor)
+}
+
+func (s *SQLStore) SensorSeen(device, sensor string) (time.Time, error) {
+	var firstSeen int64
+	err := s.db.QueryRow(selectSensor, device, sensor).Scan(&firstSeen)
+	if err == sql.ErrNoRows {
+		return time.Time{}, ErrNotFound
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(firstSeen, 0), nil
+}
+
+func (s *SQLStore) Session(addr lorawan.DevAddr) (*lorawan.Session, error) {
+	var nwkSKey, appSKey string
+	var fcnt int64
+
+	sess := &lorawan.Session{DevAddr: addr}
+	row := s.db.QueryRow(`SELECT dev_eui, device, app_id, nwk_s_key, app_s_key, fcnt_up
+FROM lorawan_sessions WHERE dev_addr = $1`, addr.String())
+	err := row.Scan(&sess.DevEUI, &sess.DeviceID, &sess.AppID, &nwkSKey, &appSKey, &fcnt)
+	if err == sql.ErrNoRows {
+		return nil, lorawan.ErrUnknownDevice
+	} else if err != nil {
+		return nil, err
+	}
+
+	sess.NwkSKey, err = lorawan.ParseKey(nwkSKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sess.AppSKey, err = lorawan.ParseKey(appSKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sess.FCntUp = uint32(fcnt)
+	return sess, nil
+}
+
+func (s *SQLStore) UpdateSession(sess *lorawan.Session) error {
+	res, err := s.db.Exec(`UPDATE lorawan_sessions SET fcnt_up = $1 WHERE dev_addr = $2`,
+		int64(sess.FCntUp), sess.DevAddr.String())
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return lorawan.ErrUnknownDevice
+	}
+	return nil
+}
+
+func (s *SQLStore) UseDevNonce(devEUI lorawan.EUI64, nonce uint16) error {
+	res, err := s.db.Exec(`INSERT INTO lorawan_dev_nonces (dev_eui, dev_nonce, used_at)
+VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`, devEUI.String(), nonce, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return lorawan.ErrDevNonce
+	}
+	return nil
+}
+
+func (s *SQLStore) SaveSession(sess *lorawan.Session) error {
+	_, err := s.db.Exec(`INSERT INTO lorawan_sessions (
+	dev_eui, device, app_id, dev_addr, nwk_s_key, app_s_key, fcnt_up, joined_at
+) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (dev_eui) DO UPDATE SET
+	device = excluded.device,
+	app_id = excluded.app_id,
+	dev_addr = excluded.dev_addr,
+	nwk_s_key = excluded.nwk_s_key,
+	app_s_key = excluded.app_s_key,
+	fcnt_up = excluded.fcnt_up,
+	joined_at = excluded.joined_at`,
+		sess.DevEUI, sess.DeviceID, sess.AppID, sess.DevAddr.String(),
+		hex.EncodeToString(sess.NwkSKey[:]), hex.EncodeToString(sess.AppSKey[:]),
+		int64(sess.FCntUp), time.Now().Unix())
+	return err
+}
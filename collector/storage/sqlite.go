@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// OpenSQLite opens the SQLite database at path, creating the file if
+// needed. A path of ":memory:" gives a database that goes away when
+// the store is closed. The schema is created by MigrateUp.
+func OpenSQLite(path string) (*SQLStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows one writer at a time, and each connection to
+	// ":memory:" gets a database of its own.
+	db.SetMaxOpenConns(1)
+
+	return &SQLStore{db: db, dialect: DialectSQLite}, nil
+}
+
+// sqliteUnavailable reports whether SQLite couldn't write because
+// another connection holds the lock or the disk is failing or full.
+func sqliteUnavailable(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+
+	switch sqliteErr.Code {
+	case sqlite3.ErrBusy, sqlite3.ErrLocked, sqlite3.ErrIoErr,
+		sqlite3.ErrFull, sqlite3.ErrCantOpen:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+// Package storage keeps uplinks and the readings decoded from them.
+// The collector normally stores them in Postgres; SQLite is there for
+// running on a Raspberry Pi, and Memory for tests.
+package storage
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"time"
+
+	"github.com/kisom/redenv/collector/lorawan"
+	"github.com/kisom/redenv/collector/reading"
+	"github.com/kisom/redenv/collector/ttn"
+)
+
+var (
+	// ErrNotFound is returned when a query has no results.
+	ErrNotFound = errors.New("storage: not found")
+
+	// ErrDuplicate is returned when an uplink from the same device
+	// with the same frame counter and payload has already been
+	// stored, e.g. because a webhook was delivered again.
+	ErrDuplicate = errors.New("storage: uplink already stored")
+)
+
+// A Store holds uplinks, readings and the state the collector needs
+// to decode them.
+//
+// Readings are stored with the sensor values the node sent; if they
+// were calibrated, the calibrated values are kept alongside, and the
+// readings come back from the store calibrated as they were stored.
+//
+// The LoRaWAN session methods return lorawan.ErrUnknownDevice for
+// sessions the store doesn't hold, so that the caller can fall back to
+// statically configured ones.
+type Store interface {
+	lorawan.JoinStore
+
+	// InsertUplink stores an uplink and the gateways that heard it,
+	// returning its ID. If it is a duplicate, the stored uplink's ID
+	// is returned with ErrDuplicate.
+	InsertUplink(u *ttn.Uplink, receivedAt time.Time) (string, error)
+
+	// AddReceptions records the gateways that heard an uplink that
+	// has already been stored, e.g. when a second packet forwarder
+	// passes on the same frame. Gateways already recorded for the
+	// uplink are skipped. It returns ErrNotFound if the uplink
+	// hasn't been stored.
+	AddReceptions(u *ttn.Uplink, receivedAt time.Time) error
+
+	// InsertReading stores a reading for an uplink that has already
+	// been stored, and sets its ID if it doesn't have one.
+	InsertReading(r *reading.Reading) error
+
+	// StoreUplink stores an uplink and the reading decoded from it
+	// together; if either fails, neither is stored. It sets the
+	// reading's ID and uplink. If the uplink is a duplicate, nothing
+	// is stored, the reading's uplink is set to the stored one and
+	// ErrDuplicate is returned.
+	StoreUplink(r *reading.Reading, u *ttn.Uplink) error
+
+	// Duplicates returns the number of duplicate uplinks received
+	// from each device.
+	Duplicates() (map[string]int64, error)
+
+	// LatestUplink returns the most recently received uplink. Its
+	// time is given in the device's timezone.
+	LatestUplink() (*ttn.Uplink, error)
+
+	// Uplinks returns the device's uplinks received in [from, to),
+	// oldest first, including those that couldn't be decoded.
+	Uplinks(device string, from, to time.Time) ([]*StoredUplink, error)
+
+	// ReadingFor returns the reading decoded from an uplink, with
+	// the quantities derived from it when it was stored.
+	ReadingFor(uplink string) (*StoredReading, error)
+
+	// ReplaceReadings stores each reading in place of the one
+	// decoded from the same uplink, if there is one, deletes the
+	// readings decoded from the removed uplinks and records the
+	// sensors as first seen, unless they have been seen already.
+	// Either all of the changes are made or none are.
+	ReplaceReadings(readings []*reading.Reading, removed []string, sensors []Sensor) error
+
+	// Latest returns the device's most recently recorded reading.
+	Latest(device string) (*reading.Reading, error)
+
+	// Readings returns the device's readings recorded in [from, to),
+	// oldest first.
+	Readings(device string, from, to time.Time) ([]*reading.Reading, error)
+
+	// Calibrations returns the device's calibration profiles.
+	Calibrations(device string) ([]reading.Calibration, error)
+
+	// SensorFirstSeen returns when a device's sensor was first
+	// seen, recording it as seen at when if it's new.
+	SensorFirstSeen(device, sensor string, when time.Time) (time.Time, error)
+
+	// SensorSeen returns when a device's sensor was first seen,
+	// without recording anything; it returns ErrNotFound for a
+	// sensor that hasn't been seen.
+	SensorSeen(device, sensor string) (time.Time, error)
+
+	Close() error
+}
+
+// Unavailable reports whether err means the database couldn't be
+// reached or was too busy to answer, rather than that it refused the
+// data; the same write may succeed later.
+func Unavailable(err error) bool {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone),
+		errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return true
+	case errors.As(err, &netErr):
+		return true
+	}
+	return pqUnavailable(err) || sqliteUnavailable(err)
+}
+
+// A StoredUplink is an uplink as it was stored.
+type StoredUplink struct {
+	ID         string
+	ReceivedAt time.Time
+	Uplink     *ttn.Uplink
+}
+
+// Derived holds the quantities worked out from a reading, which are
+// stored with it. Each is NaN if it couldn't be worked out.
+type Derived struct {
+	DewPoint             float64
+	HeatIndex            float64
+	AbsoluteHumidity     float64
+	VaporPressureDeficit float64
+	SeaLevelPressure     float64
+}
+
+// Derive works out a reading's derived quantities as they would be
+// stored now.
+func Derive(r *reading.Reading) Derived {
+	return Derived{
+		DewPoint:             r.DewPoint(),
+		HeatIndex:            r.HeatIndex(),
+		AbsoluteHumidity:     r.AbsoluteHumidity(),
+		VaporPressureDeficit: r.VaporPressureDeficit(),
+		SeaLevelPressure:     r.SeaLevelPressure(),
+	}
+}
+
+// A Sensor is a device's sensor and when it was first seen.
+type Sensor struct {
+	Device    string
+	Sensor    string
+	FirstSeen time.Time
+}
+
+// A StoredReading is a reading with the quantities that were derived
+// from it when it was stored.
+type StoredReading struct {
+	*reading.Reading
+	Derived Derived
+}
+
+// nullFloat stores a derived quantity that couldn't be worked out as
+// NULL.
+func nullFloat(v float64) interface{} {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return v
+}
+
+// originalTime returns the time in the payload if it was corrected,
+// or nil.
+func originalTime(r *reading.Reading) interface{} {
+	if !r.TimeCorrected {
+		return nil
+	}
+	return r.OriginalWhen.Unix()
+}
+
+// payloadFields returns the uplink's decoded fields as a JSON string,
+// or nil if there weren't any.
+func payloadFields(u *ttn.Uplink) interface{} {
+	if len(u.PayloadFields) == 0 || string(u.PayloadFields) == "null" {
+		return nil
+	}
+	return string(u.PayloadFields)
+}
+
+// uplinkTime formats the time an uplink was received in the device's
+// timezone. RFC 3339 keeps the offset, so the time survives being
+// parsed again when the reading is decoded.
+func uplinkTime(device string, receivedAt int64) string {
+	return time.Unix(receivedAt, 0).In(reading.DeviceTimezone(device)).Format(time.RFC3339)
+}
@@ -0,0 +1,386 @@
+package storage
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kisom/goutils/assert"
+	"github.com/kisom/redenv/collector/lorawan"
+	"github.com/kisom/redenv/collector/reading"
+	"github.com/kisom/redenv/collector/ttn"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+var start = time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+func testUplink(counter int) *ttn.Uplink {
+	lat := ttn.Number(37.823)
+	return &ttn.Uplink{
+		AppID:          "fls",
+		DevID:          "backyard",
+		HardwareSerial: "009CB1747141CD05",
+		Port:           1,
+		Counter:        counter,
+		PayloadRaw:     string(rune('A' + counter)),
+		Metadata: ttn.Metadata{
+			Frequency:  904.3,
+			Modulation: "LORA",
+			DataRate:   "SF7BW125",
+			Latitude:   &lat,
+			Gateways: []ttn.Gateway{
+				{GatewayID: "far", Timestamp: 1, RSSI: -110, SNR: -5},
+				{GatewayID: "near", Timestamp: 2, RSSI: -60, SNR: 9.25,
+					Time: "2026-10-17T12:00:05Z"},
+			},
+		},
+	}
+}
+
+func testReading(when time.Time) *reading.Reading {
+	elevation := 12.5
+	return &reading.Reading{
+		ReceivedAt:   when.Add(5 * time.Second),
+		Device:       "backyard",
+		When:         when,
+		Hardware:     reading.HardwareBME280 | reading.HardwareCCS811,
+		Uptime:       3600,
+		Temperature:  21.5,
+		Humidity:     45,
+		Pressure:     101325,
+		CO2:          415,
+		TVOC:         3,
+		Voltage:      84,
+		Layout:       "redenv/2",
+		Elevation:    &elevation,
+		Measurements: []reading.Measurement{{Name: "wind", Value: 3.5, Unit: "m/s"}},
+	}
+}
+
+// testStore checks that a store gives back what was put in it.
+// addCalibration adds a calibration in whatever way the store needs.
+func testStore(t *testing.T, s Store, addCalibration func(reading.Calibration) error) {
+	_, err := s.LatestUplink()
+	assert.ErrorEqT(t, err, ErrNotFound)
+	_, err = s.Latest("backyard")
+	assert.ErrorEqT(t, err, ErrNotFound)
+
+	var stored []*reading.Reading
+	for i := 0; i < 3; i++ {
+		r := testReading(start.Add(time.Duration(i) * time.Hour))
+		if i == 1 {
+			r.Hardware = reading.HardwareBME280
+			r.Missing = reading.FlagPressure
+			r.CO2, r.TVOC = -1, -1
+			r.TimeCorrected = true
+			r.OriginalWhen = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+			r.Measurements = nil
+		}
+
+		if i == 2 {
+			r.Calibrate([]reading.Calibration{
+				{Device: "backyard", Quantity: reading.QuantityTemperature, Offset: -0.5},
+			})
+		}
+
+		assert.NoErrorT(t, s.StoreUplink(r, testUplink(i)))
+		assert.BoolT(t, r.ID != "" && r.Uplink != "", "IDs set")
+		stored = append(stored, r)
+	}
+
+	u, err := s.LatestUplink()
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, u.Counter == 2, "latest uplink")
+	assert.BoolT(t, u.Metadata.Time == "2026-10-17T14:00:05Z", u.Metadata.Time)
+	assert.BoolT(t, *u.Metadata.Latitude == 37.823, "latitude")
+	assert.BoolT(t, len(u.Metadata.Gateways) == 2, "gateways")
+	assert.BoolT(t, u.Metadata.Gateways[0].GatewayID == "near", "strongest gateway first")
+	assert.BoolT(t, u.Metadata.Gateways[0].Time == "2026-10-17T12:00:05Z", "gateway time")
+
+	latest, err := s.Latest("backyard")
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, latest.ID == stored[2].ID, "latest reading")
+	assert.BoolT(t, latest.Temperature == 21, "calibrated temperature")
+	assert.BoolT(t, latest.Raw != nil && latest.Raw.Temperature == 21.5, "raw temperature")
+	assert.BoolT(t, *latest.Elevation == 12.5, "elevation")
+	assert.BoolT(t, reflect.DeepEqual(latest.Measurements, stored[2].Measurements),
+		"measurements")
+
+	_, err = s.Latest("frontyard")
+	assert.ErrorEqT(t, err, ErrNotFound)
+
+	readings, err := s.Readings("backyard", start.Add(time.Hour), start.Add(3*time.Hour))
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, len(readings) == 2, "range")
+	r := readings[0]
+	assert.BoolT(t, r.ID == stored[1].ID, "oldest first")
+	assert.BoolT(t, r.NullCO2() == nil && r.NullTVOC() == nil, "CCS811 absent")
+	assert.BoolT(t, r.NullPressure() == nil && r.Missing == reading.FlagPressure,
+		"pressure not in the payload")
+	assert.BoolT(t, r.NullHumidity() != nil, "humidity")
+	assert.BoolT(t, r.TimeCorrected && r.OriginalWhen.Year() == 2000, "original time")
+	assert.BoolT(t, r.Raw == nil, "uncalibrated")
+	assert.BoolT(t, r.ReceivedAt.Equal(stored[1].ReceivedAt), "received")
+
+	readings, err = s.Readings("backyard", start.Add(-time.Hour), start)
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, len(readings) == 0, "to is exclusive")
+
+	id, err := s.InsertUplink(testUplink(3), start.Add(4*time.Hour))
+	assert.NoErrorT(t, err)
+	r = testReading(start.Add(4 * time.Hour))
+	r.Uplink = id
+	assert.NoErrorT(t, s.InsertReading(r))
+	latest, err = s.Latest("backyard")
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, latest.Uplink == id, "reading for inserted uplink")
+
+	cal := reading.Calibration{
+		Device:   "backyard",
+		Quantity: reading.QuantityHumidity,
+		Table: []reading.CalibrationPoint{
+			{Raw: 10, Value: 12},
+			{Raw: 90, Value: 86},
+		},
+		ValidFrom: start,
+	}
+	assert.NoErrorT(t, addCalibration(cal))
+	cals, err := s.Calibrations("backyard")
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, len(cals) == 1 && reflect.DeepEqual(cals[0].Table, cal.Table),
+		"calibration table")
+	assert.BoolT(t, cals[0].ValidFrom.Equal(start) && cals[0].ValidUntil.IsZero(),
+		"calibration validity")
+
+	_, err = s.SensorSeen("backyard", "ccs811")
+	assert.ErrorEqT(t, err, ErrNotFound)
+	firstSeen, err := s.SensorFirstSeen("backyard", "ccs811", start)
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, firstSeen.Equal(start), "first seen")
+	firstSeen, err = s.SensorSeen("backyard", "ccs811")
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, firstSeen.Equal(start), "seen")
+	firstSeen, err = s.SensorFirstSeen("backyard", "ccs811", start.Add(time.Hour))
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, firstSeen.Equal(start), "still first seen")
+
+	testDuplicates(t, s)
+	testReceptions(t, s)
+	testReplace(t, s)
+	testSessions(t, s)
+}
+
+func testReplace(t *testing.T, s Store) {
+	// An uplink that couldn't be decoded has no reading.
+	u := testUplink(9)
+	u.DevID = "garage"
+	undecoded, err := s.InsertUplink(u, start)
+	assert.NoErrorT(t, err)
+	_, err = s.ReadingFor(undecoded)
+	assert.ErrorEqT(t, err, ErrNotFound)
+
+	old := testReading(start.Add(time.Minute))
+	old.Device = "garage"
+	u = testUplink(10)
+	u.DevID = "garage"
+	assert.NoErrorT(t, s.StoreUplink(old, u))
+
+	uplinks, err := s.Uplinks("garage", start, start.Add(time.Hour))
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, len(uplinks) == 2, "uplinks in range")
+	assert.BoolT(t, uplinks[0].ID == undecoded && uplinks[1].ID == old.Uplink, "oldest first")
+	assert.BoolT(t, uplinks[1].Uplink.Counter == 10 && uplinks[1].ReceivedAt.Equal(old.ReceivedAt),
+		"stored uplink")
+	assert.BoolT(t, len(uplinks[1].Uplink.Metadata.Gateways) == 2, "gateways")
+
+	uplinks, err = s.Uplinks("garage", start.Add(time.Minute), start.Add(time.Hour))
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, len(uplinks) == 1, "from is inclusive")
+
+	stored, err := s.ReadingFor(old.Uplink)
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, stored.ID == old.ID, "reading for uplink")
+	derived := Derive(old)
+	assert.BoolT(t, math.Abs(stored.Derived.SeaLevelPressure-derived.SeaLevelPressure) < 0.01,
+		"stored sea-level pressure")
+	assert.BoolT(t, math.Abs(stored.Derived.DewPoint-derived.DewPoint) < 0.01, "stored dew point")
+
+	gone := testReading(start.Add(2 * time.Minute))
+	gone.Device = "garage"
+	u = testUplink(11)
+	u.DevID = "garage"
+	assert.NoErrorT(t, s.StoreUplink(gone, u))
+
+	updated := testReading(start.Add(time.Minute))
+	updated.Device = "garage"
+	updated.ID = old.ID
+	updated.Uplink = old.Uplink
+	updated.Temperature = 19
+	updated.Measurements = nil
+
+	created := testReading(start)
+	created.Device = "garage"
+	created.Uplink = undecoded
+	_, err = s.SensorFirstSeen("garage", "bme280", start)
+	assert.NoErrorT(t, err)
+	sensors := []Sensor{
+		{Device: "garage", Sensor: "ccs811", FirstSeen: start},
+		{Device: "garage", Sensor: "bme280", FirstSeen: start.Add(time.Hour)},
+	}
+	assert.NoErrorT(t, s.ReplaceReadings([]*reading.Reading{updated, created},
+		[]string{gone.Uplink}, sensors))
+	assert.BoolT(t, created.ID != "", "created reading has an ID")
+
+	firstSeen, err := s.SensorSeen("garage", "ccs811")
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, firstSeen.Equal(start), "sensor recorded")
+	firstSeen, err = s.SensorSeen("garage", "bme280")
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, firstSeen.Equal(start), "sensor already seen")
+
+	_, err = s.ReadingFor(gone.Uplink)
+	assert.ErrorEqT(t, err, ErrNotFound)
+
+	readings, err := s.Readings("garage", start, start.Add(time.Hour))
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, len(readings) == 2, "one reading per decoded uplink")
+	assert.BoolT(t, readings[0].ID == created.ID, "created")
+	assert.BoolT(t, readings[1].ID == old.ID && readings[1].Temperature == 19, "updated")
+	assert.BoolT(t, len(readings[1].Measurements) == 0, "old measurements removed")
+}
+
+func testReceptions(t *testing.T, s Store) {
+	u := testUplink(20)
+	u.DevID = "shed"
+	assert.ErrorEqT(t, s.AddReceptions(u, start), ErrNotFound)
+
+	u.Metadata.Gateways = u.Metadata.Gateways[:1]
+	_, err := s.InsertUplink(u, start)
+	assert.NoErrorT(t, err)
+
+	// The second gateway forwards the same frame; the first one's
+	// reception is already recorded.
+	again := testUplink(20)
+	again.DevID = "shed"
+	assert.NoErrorT(t, s.AddReceptions(again, start))
+
+	uplinks, err := s.Uplinks("shed", start, start.Add(time.Hour))
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, len(uplinks) == 1, "one uplink")
+	gateways := uplinks[0].Uplink.Metadata.Gateways
+	assert.BoolT(t, len(gateways) == 2, "reception added once")
+	assert.BoolT(t, gateways[0].GatewayID == "near", "strongest gateway first")
+
+	duplicates, err := s.Duplicates()
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, duplicates["shed"] == 0, "not a duplicate")
+}
+
+func testDuplicates(t *testing.T, s Store) {
+	u := testUplink(5)
+	u.DevID = "frontyard"
+	first := testReading(start)
+	first.Device = "frontyard"
+	assert.NoErrorT(t, s.StoreUplink(first, u))
+
+	again := testReading(start)
+	again.Device = "frontyard"
+	assert.ErrorEqT(t, s.StoreUplink(again, u), ErrDuplicate)
+	assert.BoolT(t, again.Uplink == first.Uplink, "stored uplink")
+	id, err := s.InsertUplink(u, start)
+	assert.ErrorEqT(t, err, ErrDuplicate)
+	assert.BoolT(t, id == first.Uplink, "stored uplink ID")
+
+	readings, err := s.Readings("frontyard", start, start.Add(time.Hour))
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, len(readings) == 1, "duplicate reading not stored")
+
+	// A node may send the same payload with a new frame counter.
+	u.Counter++
+	assert.NoErrorT(t, s.StoreUplink(testReading(start), u))
+
+	duplicates, err := s.Duplicates()
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, duplicates["frontyard"] == 2 && duplicates["backyard"] == 0,
+		"duplicates counted per device")
+}
+
+func testSessions(t *testing.T, s Store) {
+	addr := lorawan.DevAddr{0x26, 0x01, 0x1b, 0xda}
+	_, err := s.Session(addr)
+	assert.ErrorEqT(t, err, lorawan.ErrUnknownDevice)
+
+	sess := &lorawan.Session{
+		DevEUI:   "009CB1747141CD05",
+		DeviceID: "backyard",
+		AppID:    "fls",
+		DevAddr:  addr,
+		NwkSKey:  [16]byte{1, 2, 3},
+		AppSKey:  [16]byte{4, 5, 6},
+	}
+	assert.ErrorEqT(t, s.UpdateSession(sess), lorawan.ErrUnknownDevice)
+	assert.NoErrorT(t, s.SaveSession(sess))
+
+	sess.FCntUp = 10
+	assert.NoErrorT(t, s.UpdateSession(sess))
+	got, err := s.Session(addr)
+	assert.NoErrorT(t, err)
+	assert.BoolT(t, reflect.DeepEqual(got, sess), "session")
+
+	eui := lorawan.EUI64{0, 0x9c, 0xb1, 0x74, 0x71, 0x41, 0xcd, 0x05}
+	assert.NoErrorT(t, s.UseDevNonce(eui, 1))
+	assert.ErrorEqT(t, s.UseDevNonce(eui, 1), lorawan.ErrDevNonce)
+	assert.NoErrorT(t, s.UseDevNonce(eui, 2))
+}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	testStore(t, m, m.AddCalibration)
+}
+
+func TestSQLite(t *testing.T) {
+	s, err := OpenSQLite(":memory:")
+	assert.NoErrorT(t, err)
+	defer s.Close()
+
+	_, err = s.MigrateUp(0)
+	assert.NoErrorT(t, err)
+
+	testStore(t, s, func(c reading.Calibration) error {
+		_, err := s.DB().Exec(`INSERT INTO calibrations (id, device, quantity, points, valid_from)
+VALUES ('1', $1, $2, $3, $4)`, c.Device, c.Quantity, `[[10, 12], [90, 86]]`, c.ValidFrom.Unix())
+		return err
+	})
+}
+
+func TestUnavailable(t *testing.T) {
+	unavailable := []error{
+		driver.ErrBadConn,
+		fmt.Errorf("storing uplink: %w", sql.ErrConnDone),
+		&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+		&pq.Error{Code: "08006"},
+		&pq.Error{Code: "57P01"},
+		sqlite3.Error{Code: sqlite3.ErrBusy},
+	}
+	for _, err := range unavailable {
+		assert.BoolT(t, Unavailable(err), err.Error())
+	}
+
+	refused := []error{
+		nil,
+		ErrDuplicate,
+		errors.New("reading: can't calibrate co2"),
+		&pq.Error{Code: "23505"},
+		sqlite3.Error{Code: sqlite3.ErrConstraint},
+	}
+	for _, err := range refused {
+		assert.BoolT(t, !Unavailable(err), fmt.Sprint(err))
+	}
+}
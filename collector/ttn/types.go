@@ -0,0 +1,58 @@
+package ttn
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+)
+
+// Number is a numeric field that may be sent either as a JSON number
+// or as a string holding one.
+type Number float64
+
+func (n *Number) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		if s == "" {
+			*n = 0
+			return nil
+		}
+		data = []byte(s)
+	}
+
+	f, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return err
+	}
+
+	*n = Number(f)
+	return nil
+}
+
+// Text is a string field that may be sent as a JSON number; the bit
+// rate of FSK uplinks is, for example.
+type Text string
+
+func (t *Text) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = Text(s)
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+
+	*t = Text(n.String())
+	return nil
+}
@@ -2,6 +2,7 @@ package ttn
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -9,27 +10,114 @@ import (
 	"github.com/kisom/redenv/collector/util"
 )
 
+// Message is an uplink from one of the TTN integrations. Every
+// format can be decoded into a reading, and converted to the v2
+// Uplink that the collector stores.
+type Message interface {
+	ToReading() (*reading.Reading, error)
+	Uplink() *Uplink
+}
+
+// Parse decodes a webhook body, detecting whether it was sent by the
+// v2 HTTP integration or a v3 webhook.
+func Parse(data []byte) (Message, error) {
+	var probe struct {
+		EndDeviceIDs *json.RawMessage `json:"end_device_ids"`
+	}
+
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+
+	if probe.EndDeviceIDs == nil {
+		u := &Uplink{}
+		if err := json.Unmarshal(data, u); err != nil {
+			return nil, err
+		}
+		return u, nil
+	}
+
+	u := &V3Uplink{}
+	if err := json.Unmarshal(data, u); err != nil {
+		return nil, err
+	}
+
+	if u.UplinkMessage == nil {
+		return nil, ErrNotUplink
+	}
+	return u, nil
+}
+
 type Uplink struct {
-	AppID          string   `json:"app_id"`
-	DevID          string   `json:"dev_id"`
-	HardwareSerial string   `json:"hardware_serial"`
-	Port           int      `json:"port"`
-	Counter        int      `json:"counter"`
-	IsRetry        bool     `json:"is_retry"`
-	Confirmed      bool     `json:"confirmed"`
-	PayloadRaw     string   `json:"payload_raw"`
-	Metadata       Metadata `json:"metadata"`
+	AppID          string          `json:"app_id"`
+	DevID          string          `json:"dev_id"`
+	HardwareSerial string          `json:"hardware_serial"`
+	Port           int             `json:"port"`
+	Counter        int             `json:"counter"`
+	IsRetry        bool            `json:"is_retry"`
+	Confirmed      bool            `json:"confirmed"`
+	PayloadRaw     string          `json:"payload_raw"`
+	PayloadFields  json.RawMessage `json:"payload_fields"`
+	Metadata       Metadata        `json:"metadata"`
+	DownlinkURL    string          `json:"downlink_url"`
 }
 
+// Metadata describes how an uplink was received. The device location
+// is only present if it has been set in the console.
 type Metadata struct {
-	Time       string  `json:"time"`
-	Frequency  float32 `json:"frequency"`
-	Modulation string  `json:"modulation"`
-	DataRate   string  `json:"data_rate"`
-	BitRate    string  `json:"bit_rate"`
+	Time       string    `json:"time"`
+	Frequency  Number    `json:"frequency"`
+	Modulation Text      `json:"modulation"`
+	DataRate   Text      `json:"data_rate"`
+	BitRate    Text      `json:"bit_rate"`
+	CodingRate Text      `json:"coding_rate"`
+	Gateways   []Gateway `json:"gateways"`
+	Latitude   *Number   `json:"latitude"`
+	Longitude  *Number   `json:"longitude"`
+	Altitude   *Number   `json:"altitude"`
 }
 
-func (u Uplink) ToReading() (*reading.Reading, error) {
+// Location returns the device location, if it is known.
+func (md Metadata) Location() string {
+	if md.Latitude == nil || md.Longitude == nil {
+		return "unknown"
+	}
+
+	loc := fmt.Sprintf("%0.4f, %0.4f", *md.Latitude, *md.Longitude)
+	if md.Altitude != nil {
+		loc += fmt.Sprintf(" (%0.0f m)", *md.Altitude)
+	}
+	return loc
+}
+
+// Gateway is a single gateway's reception of an uplink. The location
+// is left out when the gateway hasn't reported one.
+type Gateway struct {
+	GatewayID string   `json:"gtw_id"`
+	Timestamp uint32   `json:"timestamp"`
+	Time      string   `json:"time"`
+	Channel   int      `json:"channel"`
+	RSSI      float32  `json:"rssi"`
+	SNR       float32  `json:"snr"`
+	RFChain   int      `json:"rf_chain"`
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Altitude  *float64 `json:"altitude"`
+}
+
+func (gw Gateway) String() string {
+	s := fmt.Sprintf("%s: RSSI %0.0f dBm, SNR %0.1f dB, channel %d",
+		gw.GatewayID, gw.RSSI, gw.SNR, gw.Channel)
+	if gw.Latitude != nil && gw.Longitude != nil {
+		s += fmt.Sprintf(" @ %0.4f, %0.4f", *gw.Latitude, *gw.Longitude)
+	}
+	return s
+}
+
+// Uplink returns u; the v2 format is already the stored form.
+func (u *Uplink) Uplink() *Uplink { return u }
+
+func (u *Uplink) ToReading() (*reading.Reading, error) {
 	r := &reading.Reading{}
 	r.Device = u.DevID
 
@@ -47,38 +135,26 @@ func (u Uplink) ToReading() (*reading.Reading, error) {
 			return nil, err
 		}
 	}
-	err = r.Unmarshal(payload)
+	err = r.Decode(u.Port, payload)
 	return r, err
 }
 
-func (u Uplink) String() string {
-	r := &reading.Reading{}
-	r.Device = u.DevID
-
-	payload, err := base64.StdEncoding.DecodeString(u.PayloadRaw)
+// String describes the uplink and the reading decoded from it. Uplinks
+// whose payloads couldn't be decoded are stored too, so the error is
+// shown in place of the reading.
+func (u *Uplink) String() string {
+	var decoded interface{}
+	r, err := u.ToReading()
 	if err != nil {
-		// things should have been validated by here, and if
-		// you haven't then the app deserves to crash
-		panic(err)
+		decoded = fmt.Sprintf("payload couldn't be decoded: %s (raw payload %s)\n",
+			err, u.PayloadRaw)
+	} else {
+		decoded = r
 	}
 
-	r.ReceivedAt, err = time.Parse(time.RFC3339, u.Metadata.Time)
-	if err != nil {
-		// When getting uplinks from the database, the time is
-		// stored in a slightly saner format.
-		r.ReceivedAt, err = time.Parse(util.TimeFormat, u.Metadata.Time)
-		if err != nil {
-			// things should have been validated by here,
-			// and if you haven't then the app deserves to
-			// crash
-			panic(err)
-		}
-	}
-	err = r.Unmarshal(payload)
-	if err != nil {
-		// things should have been validated by here, and if
-		// you haven't then the app deserves to crash
-		panic(err)
+	gateways := ""
+	for _, gw := range u.Metadata.Gateways {
+		gateways += fmt.Sprintf("\t\t%s\n", gw)
 	}
 
 	return fmt.Sprintf(`Uplink[%s] from %s[%s] @ %s
@@ -90,13 +166,17 @@ func (u Uplink) String() string {
 	Modulation: %s
 	Data rate: %s
 	Bit rate: %s
-Reading:
+	Coding rate: %s
+	Device location: %s
+	Gateways: %d
+%sReading:
 %s
 
 `, u.AppID, u.DevID, u.HardwareSerial, u.Metadata.Time, u.Port,
 		u.Counter, util.YOrN(u.IsRetry), util.YOrN(u.Confirmed),
 		u.Metadata.Frequency, u.Metadata.Modulation,
-		u.Metadata.DataRate, u.Metadata.BitRate, r)
+		u.Metadata.DataRate, u.Metadata.BitRate, u.Metadata.CodingRate,
+		u.Metadata.Location(), len(u.Metadata.Gateways), gateways, decoded)
 }
 
 /*
@@ -0,0 +1,187 @@
+package ttn
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kisom/goutils/assert"
+)
+
+var v2Uplink = []byte(`{
+  "app_id": "fls",
+  "dev_id": "backyard",
+  "hardware_serial": "009CB1747141CD05",
+  "port": 1,
+  "counter": 2,
+  "is_retry": false,
+  "confirmed": false,
+  "payload_raw": "4wcKHQseBA+rCAAAr0edQRyF80AAqvRBwnvGRz8CAAAaAAAA/QABAAA=",
+  "metadata": {
+    "time": "2019-10-29T11:30:05.094175318Z",
+    "frequency": 904.3,
+    "modulation": "LORA",
+    "data_rate": "SF7BW125",
+    "coding_rate": "4/5",
+    "gateways": [
+      {
+        "gtw_id": "eui-b827ebfffe5e1a2b",
+        "timestamp": 2829011,
+        "time": "2019-10-29T11:30:05.081Z",
+        "channel": 2,
+        "rssi": -79,
+        "snr": 9.25,
+        "rf_chain": 0
+      }
+    ]
+  }
+}`)
+
+var v3Uplink = []byte(`{
+  "end_device_ids": {
+    "device_id": "backyard",
+    "application_ids": {"application_id": "fls"},
+    "dev_eui": "009CB1747141CD05",
+    "join_eui": "70B3D57ED0023F4B",
+    "dev_addr": "260214E3"
+  },
+  "correlation_ids": ["as:up:01E0ZQGR3J7TY6ZW1ZMWX5GYAC"],
+  "received_at": "2019-10-29T11:30:05.120987654Z",
+  "uplink_message": {
+    "session_key_id": "AXA3...",
+    "f_port": 1,
+    "f_cnt": 2,
+    "frm_payload": "4wcKHQseBA+rCAAAr0edQRyF80AAqvRBwnvGRz8CAAAaAAAA/QABAAA=",
+    "rx_metadata": [{
+      "gateway_ids": {"gateway_id": "fls-gw", "eui": "B827EBFFFE5E1A2B"},
+      "time": "2019-10-29T11:30:05.081Z",
+      "timestamp": 2829011,
+      "rssi": -79,
+      "channel_rssi": -79,
+      "snr": 9.25,
+      "channel_index": 2,
+      "location": {"latitude": 37.823, "longitude": -122.284, "altitude": 10}
+    }],
+    "settings": {
+      "data_rate": {"lora": {"bandwidth": 125000, "spreading_factor": 7}},
+      "coding_rate": "4/5",
+      "frequency": "904300000",
+      "timestamp": 2829011
+    },
+    "received_at": "2019-10-29T11:30:05.094175318Z",
+    "consumed_airtime": "0.097536s"
+  }
+}`)
+
+func TestParseV2(t *testing.T) {
+	msg, err := Parse(v2Uplink)
+	assert.NoErrorT(t, err)
+
+	_, ok := msg.(*Uplink)
+	assert.BoolT(t, ok, "v2 uplink should decode as Uplink")
+	assert.BoolT(t, msg.Uplink().DevID == "backyard", "device ID")
+
+	gateways := msg.Uplink().Metadata.Gateways
+	assert.BoolT(t, len(gateways) == 1, "gateways")
+	assert.BoolT(t, gateways[0].GatewayID == "eui-b827ebfffe5e1a2b", "gateway ID")
+	assert.BoolT(t, gateways[0].Latitude == nil, "gateway without a location")
+}
+
+func TestParseV3(t *testing.T) {
+	msg, err := Parse(v3Uplink)
+	assert.NoErrorT(t, err)
+
+	_, ok := msg.(*V3Uplink)
+	assert.BoolT(t, ok, "v3 uplink should decode as V3Uplink")
+
+	u := msg.Uplink()
+	assert.BoolT(t, u.AppID == "fls", "app ID")
+	assert.BoolT(t, u.DevID == "backyard", "device ID")
+	assert.BoolT(t, u.HardwareSerial == "009CB1747141CD05", "hardware serial")
+	assert.BoolT(t, u.Port == 1, "port")
+	assert.BoolT(t, u.Counter == 2, "counter")
+	assert.BoolT(t, u.Metadata.Modulation == "LORA", "modulation")
+	assert.BoolT(t, u.Metadata.DataRate == "SF7BW125", "data rate")
+	assert.BoolT(t, u.Metadata.Frequency > 904.29 && u.Metadata.Frequency < 904.31, "frequency")
+
+	assert.BoolT(t, len(u.Metadata.Gateways) == 1, "gateways")
+	gw := u.Metadata.Gateways[0]
+	assert.BoolT(t, gw.GatewayID == "fls-gw", "gateway ID")
+	assert.BoolT(t, gw.RSSI == -79, "RSSI")
+	assert.BoolT(t, gw.Channel == 2, "channel")
+	assert.BoolT(t, gw.Latitude != nil && *gw.Latitude == 37.823, "latitude")
+}
+
+func TestParseV3NotUplink(t *testing.T) {
+	_, err := Parse([]byte(`{
+  "end_device_ids": {"device_id": "backyard"},
+  "join_accept": {"session_key_id": "AXA3..."}
+}`))
+	assert.ErrorEqT(t, ErrNotUplink, err)
+}
+
+func TestSameReading(t *testing.T) {
+	m2, err := Parse(v2Uplink)
+	assert.NoErrorT(t, err)
+	m3, err := Parse(v3Uplink)
+	assert.NoErrorT(t, err)
+
+	r2, err := m2.ToReading()
+	assert.NoErrorT(t, err)
+	r3, err := m3.ToReading()
+	assert.NoErrorT(t, err)
+
+	expectedDate := time.Date(2019, 10, 29, 11, 30, 4, 0, time.UTC)
+	assert.BoolT(t, r3.When.Equal(expectedDate), "timestamp")
+	assert.BoolT(t, r2.ReceivedAt.Equal(r3.ReceivedAt), "received at")
+	assert.BoolT(t, r2.Device == r3.Device, "device")
+	assert.BoolT(t, reflect.DeepEqual(r2, r3), "readings should match")
+}
+
+func TestParseV2Metadata(t *testing.T) {
+	msg, err := Parse([]byte(`{
+  "app_id": "fls",
+  "dev_id": "backyard",
+  "hardware_serial": "009CB1747141CD05",
+  "port": 1,
+  "counter": 3,
+  "payload_raw": "4wcKHQseBA+rCAAAr0edQRyF80AAqvRBwnvGRz8CAAAaAAAA/QABAAA=",
+  "payload_fields": {"temperature": 19.66},
+  "metadata": {
+    "time": "2019-10-29T11:30:05.094175318Z",
+    "frequency": "904.3",
+    "modulation": "FSK",
+    "bit_rate": 50000,
+    "coding_rate": "4/5",
+    "latitude": 37.823,
+    "longitude": -122.284,
+    "altitude": 10
+  },
+  "downlink_url": "https://integrations.thethingsnetwork.org/ttn-us-west/api/v2/down/fls/collector?key=ttn-account-v2.secret"
+}`))
+	assert.NoErrorT(t, err)
+
+	u := msg.Uplink()
+	assert.BoolT(t, u.Metadata.Frequency == 904.3, "frequency")
+	assert.BoolT(t, u.Metadata.BitRate == "50000", "bit rate")
+	assert.BoolT(t, u.Metadata.CodingRate == "4/5", "coding rate")
+	assert.BoolT(t, u.Metadata.Latitude != nil && *u.Metadata.Latitude == 37.823, "latitude")
+	assert.BoolT(t, u.Metadata.Altitude != nil && *u.Metadata.Altitude == 10, "altitude")
+	assert.BoolT(t, u.Metadata.Location() == "37.8230, -122.2840 (10 m)", "location")
+	assert.BoolT(t, string(u.PayloadFields) == `{"temperature": 19.66}`, "payload fields")
+	assert.BoolT(t, u.DownlinkURL != "", "downlink URL")
+}
+
+func TestStringUndecoded(t *testing.T) {
+	msg, err := Parse(v2Uplink)
+	assert.NoErrorT(t, err)
+	u := msg.Uplink()
+	assert.BoolT(t, strings.Contains(u.String(), "Reading:"), "decoded uplink")
+
+	u.PayloadRaw = "AQID"
+	assert.BoolT(t, strings.Contains(u.String(), "payload couldn't be decoded"), "short payload")
+
+	u.PayloadRaw = "not base64!"
+	assert.BoolT(t, strings.Contains(u.String(), "payload couldn't be decoded"), "bad base64")
+}
@@ -0,0 +1,197 @@
+package ttn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/kisom/redenv/collector/reading"
+)
+
+// ErrNotUplink is returned when a v3 webhook delivers something other
+// than an uplink message, e.g. a join accept or a downlink event.
+var ErrNotUplink = errors.New("ttn: v3 message is not an uplink")
+
+// ApplicationIDs identifies a v3 application.
+type ApplicationIDs struct {
+	ApplicationID string `json:"application_id"`
+}
+
+// EndDeviceIDs identifies the device that sent a v3 uplink.
+type EndDeviceIDs struct {
+	DeviceID       string         `json:"device_id"`
+	ApplicationIDs ApplicationIDs `json:"application_ids"`
+	DevEUI         string         `json:"dev_eui"`
+	JoinEUI        string         `json:"join_eui"`
+	DevAddr        string         `json:"dev_addr"`
+}
+
+// GatewayIDs identifies a gateway in the v3 rx_metadata.
+type GatewayIDs struct {
+	GatewayID string `json:"gateway_id"`
+	EUI       string `json:"eui"`
+}
+
+// Location is a v3 antenna location.
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Altitude  float64 `json:"altitude"`
+}
+
+// RxMetadata is a single gateway reception of a v3 uplink.
+type RxMetadata struct {
+	GatewayIDs   GatewayIDs `json:"gateway_ids"`
+	Time         string     `json:"time"`
+	Timestamp    uint32     `json:"timestamp"`
+	RSSI         float32    `json:"rssi"`
+	ChannelRSSI  float32    `json:"channel_rssi"`
+	SNR          float32    `json:"snr"`
+	ChannelIndex int        `json:"channel_index"`
+	Location     *Location  `json:"location"`
+}
+
+// LoRaDataRate is the LoRa modulation of a v3 uplink.
+type LoRaDataRate struct {
+	Bandwidth       int    `json:"bandwidth"`
+	SpreadingFactor int    `json:"spreading_factor"`
+	CodingRate      string `json:"coding_rate"`
+}
+
+// FSKDataRate is the FSK modulation of a v3 uplink.
+type FSKDataRate struct {
+	BitRate int `json:"bit_rate"`
+}
+
+// DataRate holds whichever modulation the uplink was sent with.
+type DataRate struct {
+	LoRa *LoRaDataRate `json:"lora"`
+	FSK  *FSKDataRate  `json:"fsk"`
+}
+
+// TxSettings describes how a v3 uplink was transmitted. Note that the
+// frequency is sent as a string in Hz.
+type TxSettings struct {
+	DataRate   DataRate `json:"data_rate"`
+	CodingRate string   `json:"coding_rate"`
+	Frequency  string   `json:"frequency"`
+}
+
+// UplinkMessage is the uplink_message body of a v3 webhook.
+type UplinkMessage struct {
+	FPort          int                 `json:"f_port"`
+	FCnt           int                 `json:"f_cnt"`
+	FRMPayload     string              `json:"frm_payload"`
+	DecodedPayload json.RawMessage     `json:"decoded_payload"`
+	RxMetadata     []RxMetadata        `json:"rx_metadata"`
+	Settings       TxSettings          `json:"settings"`
+	ReceivedAt     string              `json:"received_at"`
+	Confirmed      bool                `json:"confirmed"`
+	Locations      map[string]Location `json:"locations"`
+}
+
+// V3Uplink is an uplink delivered by a The Things Stack (TTN v3)
+// webhook.
+type V3Uplink struct {
+	EndDeviceIDs  EndDeviceIDs   `json:"end_device_ids"`
+	ReceivedAt    string         `json:"received_at"`
+	UplinkMessage *UplinkMessage `json:"uplink_message"`
+}
+
+func (u *V3Uplink) receivedAt() string {
+	if u.UplinkMessage.ReceivedAt != "" {
+		return u.UplinkMessage.ReceivedAt
+	}
+	return u.ReceivedAt
+}
+
+func (u *V3Uplink) frequency() Number {
+	hz, err := strconv.ParseFloat(u.UplinkMessage.Settings.Frequency, 64)
+	if err != nil {
+		return 0
+	}
+	return Number(hz / 1000000)
+}
+
+// codingRate is in the LoRa data rate in newer versions of the stack.
+func (u *V3Uplink) codingRate() Text {
+	settings := u.UplinkMessage.Settings
+	if settings.DataRate.LoRa != nil && settings.DataRate.LoRa.CodingRate != "" {
+		return Text(settings.DataRate.LoRa.CodingRate)
+	}
+	return Text(settings.CodingRate)
+}
+
+// Uplink converts the v3 uplink into the v2 form used for storage.
+func (u *V3Uplink) Uplink() *Uplink {
+	msg := u.UplinkMessage
+	v2 := &Uplink{
+		AppID:          u.EndDeviceIDs.ApplicationIDs.ApplicationID,
+		DevID:          u.EndDeviceIDs.DeviceID,
+		HardwareSerial: u.EndDeviceIDs.DevEUI,
+		Port:           msg.FPort,
+		Counter:        msg.FCnt,
+		Confirmed:      msg.Confirmed,
+		PayloadRaw:     msg.FRMPayload,
+		PayloadFields:  msg.DecodedPayload,
+		Metadata: Metadata{
+			Time:       u.receivedAt(),
+			Frequency:  u.frequency(),
+			CodingRate: u.codingRate(),
+		},
+	}
+
+	// The user-set location takes precedence over any the stack
+	// has worked out itself.
+	loc, ok := msg.Locations["user"]
+	if !ok {
+		for _, l := range msg.Locations {
+			loc, ok = l, true
+			break
+		}
+	}
+
+	if ok {
+		lat, lon, alt := Number(loc.Latitude), Number(loc.Longitude), Number(loc.Altitude)
+		v2.Metadata.Latitude = &lat
+		v2.Metadata.Longitude = &lon
+		v2.Metadata.Altitude = &alt
+	}
+
+	for _, rx := range msg.RxMetadata {
+		gw := Gateway{
+			GatewayID: rx.GatewayIDs.GatewayID,
+			Timestamp: rx.Timestamp,
+			Time:      rx.Time,
+			Channel:   rx.ChannelIndex,
+			RSSI:      rx.RSSI,
+			SNR:       rx.SNR,
+		}
+
+		if rx.Location != nil {
+			loc := *rx.Location
+			gw.Latitude = &loc.Latitude
+			gw.Longitude = &loc.Longitude
+			gw.Altitude = &loc.Altitude
+		}
+		v2.Metadata.Gateways = append(v2.Metadata.Gateways, gw)
+	}
+
+	dr := msg.Settings.DataRate
+	switch {
+	case dr.LoRa != nil:
+		v2.Metadata.Modulation = "LORA"
+		v2.Metadata.DataRate = Text(fmt.Sprintf("SF%dBW%d",
+			dr.LoRa.SpreadingFactor, dr.LoRa.Bandwidth/1000))
+	case dr.FSK != nil:
+		v2.Metadata.Modulation = "FSK"
+		v2.Metadata.BitRate = Text(strconv.Itoa(dr.FSK.BitRate))
+	}
+
+	return v2
+}
+
+func (u *V3Uplink) ToReading() (*reading.Reading, error) {
+	return u.Uplink().ToReading()
+}
@@ -4,12 +4,15 @@
 #include <SparkFunCCS811.h>
 #include "sensors.h"
 
+// This board has no GPS, so it sends the first version of the reading.
+#define READING_VERSION	1
+#include "reading.h"
+
 
 #define BME280_ID	0x60	/* from datasheet */
 #define CCS811_ADDR     0x5B	/* from datasheet */
 #define CCS811_RESET	A4
 #define PVPIN		A0	/* middle pin of the solar cell trimpot tap */
-#define READING_SIZE	39	/* how big is the reading struct in bytes */
 #define SD_CS		10	/* from Adafruit docs */
 
 
@@ -132,30 +135,6 @@ resetCCS811()
 }
 
 
-// This can be unpacked with the following Python struct format:
-// 	'<HBBBBBBIffffiiBBB'
-struct Reading {
-        uint16_t        year;   
-        uint8_t         month;
-        uint8_t         day;
-        uint8_t         hour;
-        uint8_t         minute;
-        uint8_t         second;
-        uint8_t         hw;     // available hardware
-        uint32_t        uptime;
-        float           temp;   // °C
-        float           calt;   // temperature calibration value
-        float           hum;    // % humidity
-        float           press;  // Pa
-        int             co2;    // ppb
-        int             tvoc;   // ppb
-        uint8_t         voltage;
-        uint8_t         ccs811Status;
-        uint8_t         cal;    // is temperature calibrated?
-};
-
-
-
 static void
 now(struct Reading *r)
 {
@@ -173,7 +152,7 @@ now(struct Reading *r)
 static inline void
 packReading(struct Reading *r, uint8_t *buf)
 {
-	memcpy(buf, r, 39);
+	memcpy(buf, r, READING_SIZE);
 }
 
 
@@ -0,0 +1,59 @@
+/*
+ * Code generated by payloadgen from redenv.json; DO NOT EDIT.
+ *
+ * The reading packed by the redenv firmware and sent on FPort 1.
+ * Define READING_VERSION before including this header to send an
+ * older layout. The struct is copied onto the air as is, so this
+ * assumes a little-endian MCU.
+ *
+ * It can be unpacked with the following Python struct formats:
+ * 	version 1: '<HBBBBBBIffffiiBBB'
+ * 	version 2: '<HBBBBBBIffffiiBBBBB'
+ */
+
+#ifndef REDENV_READING_H
+#define REDENV_READING_H
+
+
+#include <stdint.h>
+
+
+#ifndef READING_VERSION
+#define READING_VERSION	2
+#endif
+
+#if READING_VERSION == 1
+#define READING_SIZE	39	/* how big is the reading struct in bytes */
+#elif READING_VERSION == 2
+#define READING_SIZE	41	/* how big is the reading struct in bytes */
+#else
+#error "unknown READING_VERSION"
+#endif
+
+
+struct Reading {
+	uint16_t	year;	// when: from the RTC or GPS, UTC
+	uint8_t		month;
+	uint8_t		day;
+	uint8_t		hour;
+	uint8_t		minute;
+	uint8_t		second;
+	uint8_t		hw;	// available hardware
+	uint32_t	uptime;	// s
+	float		temp;	// °C
+	float		calt;	// temperature calibration value (°C)
+	float		hum;	// relative humidity (%)
+	float		press;	// Pa
+	int32_t		co2;	// -1 if not recorded (ppm)
+	int32_t		tvoc;	// -1 if not recorded (ppb)
+	uint8_t		voltage;	// solar cell, in tenths of a volt (V)
+	uint8_t		ccs811Status;
+	uint8_t		cal;	// is temperature calibrated?
+#if READING_VERSION >= 2
+	uint8_t		fix;	// is GPS fixed?
+	uint8_t		sats;	// number of satellites
+#endif
+} __attribute__((packed));
+
+
+#endif /* REDENV_READING_H */
@@ -1,6 +1,7 @@
 #include <Adafruit_GPS.h>
 #include <SparkFunBME280.h>
 #include <SparkFunCCS811.h>
+#include "reading.h"
 #include "sensors.h"
 #include <string.h>
 
@@ -9,7 +10,6 @@
 #define CCS811_ADDR     0x5B	/* from datasheet */
 #define CCS811_RESET	A4
 #define PVPIN		A0	/* middle pin of the solar cell trimpot tap */
-#define READING_SIZE	41	/* how big is the reading struct in bytes */
 
 
 
@@ -158,32 +158,6 @@ getVoltage()
 }
 
 
-// This can be unpacked with the following Python struct format:
-// 	'<HBBBBBBIffffiiBBBBB'
-struct Reading {
-	uint16_t        year;
-	uint8_t         month;
-	uint8_t         day;
-	uint8_t         hour;
-	uint8_t         minute;
-	uint8_t         second;
-	uint8_t         hw;     // available hardware
-	uint32_t        uptime;
-	float           temp;   // °C
-	float           calt;   // temperature calibration value
-	float           hum;    // % humidity
-	float           press;  // Pa
-	int             co2;    // ppb
-	int             tvoc;   // ppb
-	uint8_t         voltage;
-	uint8_t         ccs811Status;
-	uint8_t         cal;    // is temperature calibrated?
-	uint8_t		fix;	// is GPS fixed?
-	uint8_t		sats;	// number of satellites
-};
-
-
-
 static void
 now(struct Reading *r)
 {
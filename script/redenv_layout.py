@@ -0,0 +1,29 @@
+"""
+Code generated by payloadgen from redenv.json; DO NOT EDIT.
+
+The reading packed by the redenv firmware and sent on FPort 1.
+"""
+
+import struct
+
+CURRENT = 2
+
+# The struct format of each version.
+FORMATS = {
+    1: "<HBBBBBBIffffiiBBB",
+    2: "<HBBBBBBIffffiiBBBBB",
+}
+
+# The size of each version, in bytes.
+SIZES = {
+    1: 39,
+    2: 41,
+}
+
+
+def unpack(data):
+    """Unpack a reading, telling its version from its size."""
+    for version, size in SIZES.items():
+        if len(data) == size:
+            return struct.unpack(FORMATS[version], data)
+    raise ValueError(f"a {len(data)}-byte payload isn't a known reading")
@@ -7,12 +7,24 @@ byte-pack sent by the sensor node.
 import binascii
 import base64
 import datetime
-import struct
 import sys
 
+import redenv_layout
+
 
 CCS811_STATUS =["OK", "invalid ID", "I2C error", "internal error", "generic error"]
 
+HW_BME280 = 1
+HW_CCS811 = 2
+HW_GPS = 16
+
+
+def recorded(value, fmt="{}"):
+    """Format a sensor value, which is None if it wasn't recorded."""
+    if value is None:
+        return "not recorded"
+    return fmt.format(value)
+
 class Reading:
     __slots__ = [
         "when",
@@ -36,21 +48,31 @@ class Reading:
         self.when = datetime.datetime(year, month, day, hour, minute, second)
         self.hw = data[6]
         self.uptime = data[7]
-        self.temperature = data[8]
         self.calibration_temperature = data[9]
-        self.humidity = data[10]
-        self.pressure = data[11] / 1000.0
-        self.co2 = data[12]
-        self.tvoc = data[13]
-        self.voltage = data[14] / 100.0
+        self.voltage = data[14] / 10.0
         self.ccs811_status = data[15]
-        if data[16] == 1:
-            self.calibrated = True
-        else:
-            self.calibrated = False
-        if data[17] == 1:
-            self.fix = True
-        self.sats = data[18]
+        self.calibrated = data[16] == 1
+
+        # Values from sensors that aren't fitted or reported an
+        # error are None.
+        self.temperature = self.humidity = self.pressure = None
+        if self.hw & HW_BME280:
+            self.temperature = data[8]
+            self.humidity = data[10]
+            self.pressure = data[11] / 1000.0
+
+        self.co2 = self.tvoc = None
+        if self.hw & HW_CCS811 and self.ccs811_status == 0:
+            if data[12] != -1:
+                self.co2 = data[12]
+            if data[13] != -1:
+                self.tvoc = data[13]
+
+        self.fix = self.sats = None
+        # Version 1 readings have no GPS fields.
+        if self.hw & HW_GPS and len(data) > 17:
+            self.fix = data[17] == 1
+            self.sats = data[18]
 
     def hardware(self):
         hw = []
@@ -76,16 +98,16 @@ class Reading:
         return f"""Timestamp: {self.when}
 \tHardware: {self.hardware()} ({self.hw})
 \tUptime: {self.uptime}s
-\tTemperature: {self.temperature:0.1f}°C
+\tTemperature: {recorded(self.temperature, "{:0.1f}°C")}
 \t\tCalibrated? {self.calibrated}
 \t\tCalibration temperature: {self.calibration_temperature:0.1f}°C
-\tHumidity: {self.humidity:0.1f}%
-\tPressure: {self.pressure:0.3f} kPa
-\tCO2: {self.co2} ppm
-\tTVOC: {self.tvoc} ppb
+\tHumidity: {recorded(self.humidity, "{:0.1f}%")}
+\tPressure: {recorded(self.pressure, "{:0.3f} kPa")}
+\tCO2: {recorded(self.co2, "{} ppm")}
+\tTVOC: {recorded(self.tvoc, "{} ppb")}
 \tVoltage: {self.voltage}V
 \tCCS811 status: {self.ccs811_status_str()}
-\tSats: {self.sats} (fix={self.fix})
+\tSats: {recorded(self.sats)} (fix={recorded(self.fix)})
 """
 
 
@@ -94,7 +116,7 @@ def unpack(data):
         data = binascii.unhexlify(data.replace(" ", ""))
     except binascii.Error:
         data = base64.decodebytes(data.encode('utf-8'))
-    return struct.unpack("<HBBBBBBIffffiiBBBBB", data)
+    return redenv_layout.unpack(data)
 
 
 def translate(data):